@@ -0,0 +1,269 @@
+package linear
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrEmpty is returned when taking an item from an empty container
+	// without blocking.
+	ErrEmpty = errors.New("linear: container is empty")
+	// ErrClosed is returned when putting an item into a closed queue, or
+	// taking an item from a closed queue which has been drained.
+	ErrClosed = errors.New("linear: queue is closed")
+)
+
+// BlockingQueue is a bounded FIFO queue which is safe for multiple producers
+// and multiple consumers. Put blocks while the queue is full and Take blocks
+// while it is empty, both can be cancelled by the context. After Close, Put
+// fails with ErrClosed, while Take keeps returning the remaining items until
+// the queue is empty.
+type BlockingQueue[T any] struct {
+	mu       sync.Mutex
+	items    Deque[T]
+	capacity int
+	closed   bool
+	// notEmpty and notFull hold one token to wake up one waiter, which passes
+	// the token on if there are still items or room, and done is closed to
+	// wake up all waiters when the queue is closed.
+	notEmpty chan struct{}
+	notFull  chan struct{}
+	done     chan struct{}
+}
+
+// NewBlockingQueue returns a new queue which holds at most capacity items, it
+// panics if capacity is not positive.
+func NewBlockingQueue[T any](capacity int) *BlockingQueue[T] {
+	if capacity <= 0 {
+		panic("linear: capacity of blocking queue must be positive")
+	}
+	return &BlockingQueue[T]{
+		capacity: capacity,
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Put adds an item to the back of the queue, it waits until there is room for
+// the item, the queue is closed or the context is done.
+func (q *BlockingQueue[T]) Put(ctx context.Context, item T) error {
+	for {
+		q.mu.Lock()
+		err := q.tryPut(item)
+		if err != ErrFull {
+			q.mu.Unlock()
+			return err
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.notFull:
+		case <-q.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryPut adds an item to the back of the queue without blocking, it returns
+// ErrFull if the queue is full and ErrClosed if the queue is closed.
+func (q *BlockingQueue[T]) TryPut(item T) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.tryPut(item)
+}
+
+// Take removes and returns the item at the front of the queue, it waits until
+// there is an item, the queue is closed and drained or the context is done.
+func (q *BlockingQueue[T]) Take(ctx context.Context) (T, error) {
+	for {
+		q.mu.Lock()
+		item, err := q.tryTake()
+		if err != ErrEmpty {
+			q.mu.Unlock()
+			return item, err
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.notEmpty:
+		case <-q.done:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// TryTake removes and returns the item at the front of the queue without
+// blocking, it returns ErrEmpty if the queue is empty and ErrClosed if the
+// queue is closed and drained.
+func (q *BlockingQueue[T]) TryTake() (T, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.tryTake()
+}
+
+// Drain removes and returns all items in the queue without blocking, the
+// producers waiting for room are woken up.
+func (q *BlockingQueue[T]) Drain() []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]T, 0, q.items.Len())
+	for {
+		item, ok := q.items.PopFront()
+		if !ok {
+			break
+		}
+		items = append(items, item)
+	}
+	if len(items) > 0 {
+		signal(q.notFull)
+	}
+	return items
+}
+
+// Close closes the queue and wakes up all waiting producers and consumers.
+// Closing a closed queue has no effect.
+func (q *BlockingQueue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.done)
+}
+
+// Len returns the number of items in the queue.
+func (q *BlockingQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+// Cap returns the maximum number of items in the queue.
+func (q *BlockingQueue[T]) Cap() int {
+	return q.capacity
+}
+
+// tryPut adds the item with the lock held.
+func (q *BlockingQueue[T]) tryPut(item T) error {
+	if q.closed {
+		return ErrClosed
+	}
+	if q.items.Len() >= q.capacity {
+		return ErrFull
+	}
+	q.items.PushBack(item)
+	signal(q.notEmpty)
+	if q.items.Len() < q.capacity {
+		signal(q.notFull)
+	}
+	return nil
+}
+
+// tryTake removes the front item with the lock held.
+func (q *BlockingQueue[T]) tryTake() (T, error) {
+	item, ok := q.items.PopFront()
+	if ok {
+		signal(q.notFull)
+		if q.items.Len() > 0 {
+			signal(q.notEmpty)
+		}
+		return item, nil
+	}
+	if q.closed {
+		return item, ErrClosed
+	}
+	return item, ErrEmpty
+}
+
+// signal puts a token into the channel to wake up one waiter, it does nothing
+// if the channel already holds one.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// msNode is the node of the lock-free queue.
+type msNode[T any] struct {
+	value T
+	next  atomic.Pointer[msNode[T]]
+}
+
+// LockFreeQueue is an unbounded FIFO queue which is safe for concurrent use
+// without locks, it's the algorithm of Michael and Scott. The head always
+// points to a dummy node whose next node holds the front item, and the tail
+// points to the last or the second last node, which is fixed by whoever finds
+// it lagging behind. Nodes are never reused, so the garbage collector rules
+// out the ABA problem.
+type LockFreeQueue[T any] struct {
+	head atomic.Pointer[msNode[T]]
+	tail atomic.Pointer[msNode[T]]
+}
+
+// NewLockFreeQueue returns a new empty lock-free queue.
+func NewLockFreeQueue[T any]() *LockFreeQueue[T] {
+	q := &LockFreeQueue[T]{}
+	dummy := &msNode[T]{}
+	q.head.Store(dummy)
+	q.tail.Store(dummy)
+	return q
+}
+
+// Enqueue adds an item to the back of the queue.
+func (q *LockFreeQueue[T]) Enqueue(item T) {
+	node := &msNode[T]{value: item}
+	for {
+		tail := q.tail.Load()
+		next := tail.next.Load()
+		if tail != q.tail.Load() {
+			continue
+		}
+		if next != nil {
+			// tail is lagging behind, help to advance it
+			q.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		if tail.next.CompareAndSwap(nil, node) {
+			q.tail.CompareAndSwap(tail, node)
+			return
+		}
+	}
+}
+
+// Dequeue removes and returns the item at the front of the queue, the second
+// result is false if the queue is empty.
+func (q *LockFreeQueue[T]) Dequeue() (T, bool) {
+	for {
+		head := q.head.Load()
+		tail := q.tail.Load()
+		next := head.next.Load()
+		if head != q.head.Load() {
+			continue
+		}
+		if next == nil {
+			var zero T
+			return zero, false
+		}
+		if head == tail {
+			// tail is lagging behind, help to advance it
+			q.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		item := next.value
+		if q.head.CompareAndSwap(head, next) {
+			return item, true
+		}
+	}
+}
+
+// Empty reports whether the queue is empty at the moment.
+func (q *LockFreeQueue[T]) Empty() bool {
+	return q.head.Load().next.Load() == nil
+}
@@ -0,0 +1,294 @@
+package linear
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBlockingQueueTryPutAndTryTake(t *testing.T) {
+	// GIVEN
+	q := NewBlockingQueue[int](2)
+
+	// WHEN
+	err1 := q.TryPut(1)
+	err2 := q.TryPut(2)
+	err3 := q.TryPut(3)
+
+	// THEN
+	if err1 != nil || err2 != nil || err3 != ErrFull {
+		t.Errorf("TryPut() = %v, %v, %v, want nil, nil, ErrFull", err1, err2, err3)
+	}
+	if v, err := q.TryTake(); err != nil || v != 1 {
+		t.Errorf("TryTake() = %d, %v, want 1, nil", v, err)
+	}
+	if v, err := q.TryTake(); err != nil || v != 2 {
+		t.Errorf("TryTake() = %d, %v, want 2, nil", v, err)
+	}
+	if _, err := q.TryTake(); err != ErrEmpty {
+		t.Errorf("TryTake() = %v, want ErrEmpty", err)
+	}
+}
+
+func TestBlockingQueueCancel(t *testing.T) {
+	// GIVEN
+	q := NewBlockingQueue[int](1)
+	if err := q.Put(context.Background(), 1); err != nil {
+		t.Fatalf("Put() = %v, want nil", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// WHEN
+	err := q.Put(ctx, 2)
+
+	// THEN
+	if err != context.DeadlineExceeded {
+		t.Errorf("Put() = %v, want DeadlineExceeded", err)
+	}
+	q.Drain()
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Take(ctx); err != context.Canceled {
+		t.Errorf("Take() = %v, want Canceled", err)
+	}
+}
+
+func TestBlockingQueueClose(t *testing.T) {
+	// GIVEN
+	q := NewBlockingQueue[int](4)
+	if err := q.Put(context.Background(), 1); err != nil {
+		t.Fatalf("Put() = %v, want nil", err)
+	}
+	done := make(chan error)
+	go func() {
+		for i := 2; i <= 4; i++ {
+			if err := q.Put(context.Background(), i); err != nil {
+				t.Errorf("Put(%d) = %v, want nil", i, err)
+			}
+		}
+		done <- q.Put(context.Background(), 5)
+	}()
+
+	// WHEN
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+
+	// THEN
+	if err := <-done; err != ErrClosed {
+		t.Errorf("Put() after Close() = %v, want ErrClosed", err)
+	}
+	if err := q.TryPut(6); err != ErrClosed {
+		t.Errorf("TryPut() after Close() = %v, want ErrClosed", err)
+	}
+	for want := 1; want <= 4; want++ {
+		if v, err := q.Take(context.Background()); err != nil || v != want {
+			t.Errorf("Take() = %d, %v, want %d, nil", v, err, want)
+		}
+	}
+	if _, err := q.Take(context.Background()); err != ErrClosed {
+		t.Errorf("Take() = %v, want ErrClosed", err)
+	}
+}
+
+func TestBlockingQueueCloseWakesUpConsumers(t *testing.T) {
+	// GIVEN
+	q := NewBlockingQueue[int](1)
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := q.Take(context.Background())
+			errs <- err
+		}()
+	}
+
+	// WHEN
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+
+	// THEN
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != ErrClosed {
+			t.Errorf("Take() = %v, want ErrClosed", err)
+		}
+	}
+}
+
+func TestBlockingQueueWakesUpEveryConsumer(t *testing.T) {
+	// GIVEN
+	q := NewBlockingQueue[int](3)
+	values := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			v, err := q.Take(context.Background())
+			if err != nil {
+				t.Errorf("Take() = %v, want nil", err)
+			}
+			values <- v
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// WHEN
+	for i := 1; i <= 3; i++ {
+		if err := q.TryPut(i); err != nil {
+			t.Fatalf("TryPut(%d) = %v, want nil", i, err)
+		}
+	}
+
+	// THEN
+	sum := 0
+	for i := 0; i < 3; i++ {
+		select {
+		case v := <-values:
+			sum += v
+		case <-time.After(time.Second):
+			t.Fatal("a consumer is still waiting for the items")
+		}
+	}
+	if sum != 6 {
+		t.Errorf("sum of taken items = %d, want 6", sum)
+	}
+}
+
+func TestBlockingQueueDrain(t *testing.T) {
+	// GIVEN
+	q := NewBlockingQueue[string](3)
+	if err1, err2 := q.TryPut("a"), q.TryPut("b"); err1 != nil || err2 != nil {
+		t.Fatalf("TryPut() = %v, %v, want nil, nil", err1, err2)
+	}
+
+	// WHEN
+	items := q.Drain()
+
+	// THEN
+	if len(items) != 2 || items[0] != "a" || items[1] != "b" {
+		t.Errorf("Drain() = %v, want [a b]", items)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", q.Len())
+	}
+}
+
+func TestBlockingQueueProducersAndConsumers(t *testing.T) {
+	// GIVEN
+	q := NewBlockingQueue[int](8)
+	const producers, perProducer = 4, 1000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				if err := q.Put(context.Background(), p*perProducer+i); err != nil {
+					t.Errorf("Put() = %v, want nil", err)
+					return
+				}
+			}
+		}(p)
+	}
+
+	// WHEN
+	seen := make([]bool, producers*perProducer)
+	var mu sync.Mutex
+	var consumers sync.WaitGroup
+	for c := 0; c < 4; c++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				v, err := q.Take(context.Background())
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				seen[v] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	q.Close()
+	consumers.Wait()
+
+	// THEN
+	for v, ok := range seen {
+		if !ok {
+			t.Fatalf("item %d is lost", v)
+		}
+	}
+}
+
+func TestLockFreeQueue(t *testing.T) {
+	// GIVEN
+	q := NewLockFreeQueue[int]()
+
+	// WHEN
+	q.Enqueue(1)
+	q.Enqueue(2)
+
+	// THEN
+	if v, ok := q.Dequeue(); !ok || v != 1 {
+		t.Errorf("Dequeue() = %d, %v, want 1, true", v, ok)
+	}
+	if v, ok := q.Dequeue(); !ok || v != 2 {
+		t.Errorf("Dequeue() = %d, %v, want 2, true", v, ok)
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Dequeue() should return false")
+	}
+	if !q.Empty() {
+		t.Error("Empty() should return true")
+	}
+}
+
+func TestLockFreeQueueConcurrent(t *testing.T) {
+	// GIVEN
+	q := NewLockFreeQueue[int]()
+	const producers, perProducer = 4, 2000
+	var wg sync.WaitGroup
+
+	// WHEN
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Enqueue(p*perProducer + i)
+			}
+		}(p)
+	}
+	results := make(chan []int, producers)
+	for c := 0; c < producers; c++ {
+		go func() {
+			var got []int
+			for len(got) < perProducer {
+				if v, ok := q.Dequeue(); ok {
+					got = append(got, v)
+				}
+			}
+			results <- got
+		}()
+	}
+	wg.Wait()
+
+	// THEN
+	seen := make([]bool, producers*perProducer)
+	for c := 0; c < producers; c++ {
+		got := <-results
+		last := make(map[int]int)
+		for _, v := range got {
+			if seen[v] {
+				t.Fatalf("item %d is dequeued twice", v)
+			}
+			seen[v] = true
+			// items of one producer must come out in order
+			p := v / perProducer
+			if prev, ok := last[p]; ok && prev > v {
+				t.Fatalf("item %d is dequeued after %d", v, prev)
+			}
+			last[p] = v
+		}
+	}
+}
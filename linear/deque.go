@@ -0,0 +1,161 @@
+package linear
+
+// minDequeCap is the initial and the minimum capacity of the ring buffer of
+// a deque, it must be a power of two.
+const minDequeCap = 16
+
+// Deque is a double-ended queue backed by a ring buffer, items can be pushed
+// and popped at both ends in amortized O(1) time. The buffer doubles when it is
+// full and halves when it is only a quarter used. The zero value is an empty
+// deque ready to use.
+type Deque[T any] struct {
+	buf   []T
+	head  int // index of the front item
+	count int
+}
+
+// NewDeque returns a new empty deque.
+func NewDeque[T any]() *Deque[T] {
+	return &Deque[T]{}
+}
+
+// Len returns the number of items in the deque.
+func (d *Deque[T]) Len() int {
+	return d.count
+}
+
+// Empty returns true if the deque contains no items.
+func (d *Deque[T]) Empty() bool {
+	return d.count == 0
+}
+
+// PushFront inserts an item at the front of the deque.
+func (d *Deque[T]) PushFront(item T) {
+	d.grow()
+	d.head = d.index(-1)
+	d.buf[d.head] = item
+	d.count++
+}
+
+// PushBack inserts an item at the back of the deque.
+func (d *Deque[T]) PushBack(item T) {
+	d.grow()
+	d.buf[d.index(d.count)] = item
+	d.count++
+}
+
+// PopFront removes and returns the item at the front of the deque, the second
+// result is false if the deque is empty.
+func (d *Deque[T]) PopFront() (T, bool) {
+	var zero T
+	if d.count == 0 {
+		return zero, false
+	}
+	item := d.buf[d.head]
+	d.buf[d.head] = zero
+	d.head = d.index(1)
+	d.count--
+	d.shrink()
+	return item, true
+}
+
+// PopBack removes and returns the item at the back of the deque, the second
+// result is false if the deque is empty.
+func (d *Deque[T]) PopBack() (T, bool) {
+	var zero T
+	if d.count == 0 {
+		return zero, false
+	}
+	i := d.index(d.count - 1)
+	item := d.buf[i]
+	d.buf[i] = zero
+	d.count--
+	d.shrink()
+	return item, true
+}
+
+// Front returns the item at the front of the deque without removing it, the
+// second result is false if the deque is empty.
+func (d *Deque[T]) Front() (T, bool) {
+	if d.count == 0 {
+		var zero T
+		return zero, false
+	}
+	return d.buf[d.head], true
+}
+
+// Back returns the item at the back of the deque without removing it, the
+// second result is false if the deque is empty.
+func (d *Deque[T]) Back() (T, bool) {
+	if d.count == 0 {
+		var zero T
+		return zero, false
+	}
+	return d.buf[d.index(d.count-1)], true
+}
+
+// At returns the i-th item counted from the front of the deque, it panics if
+// i is out of range like indexing a slice.
+func (d *Deque[T]) At(i int) T {
+	if i < 0 || i >= d.count {
+		panic("linear: deque index out of range")
+	}
+	return d.buf[d.index(i)]
+}
+
+// Each calls f for every item from the front to the back of the deque with its
+// position, the iteration stops when f returns false. The deque must not be
+// modified during the iteration.
+func (d *Deque[T]) Each(f func(i int, item T) bool) {
+	for i := 0; i < d.count; i++ {
+		if !f(i, d.buf[d.index(i)]) {
+			return
+		}
+	}
+}
+
+// Clear removes all items from the deque and releases the ring buffer.
+func (d *Deque[T]) Clear() {
+	d.buf = nil
+	d.head = 0
+	d.count = 0
+}
+
+// index returns the position in the ring buffer of the i-th item counted from
+// the front, i may be negative. The length of buffer is always a power of two,
+// so the modulo is done by a bit mask.
+func (d *Deque[T]) index(i int) int {
+	return (d.head + i) & (len(d.buf) - 1)
+}
+
+// grow doubles the ring buffer when it is full.
+func (d *Deque[T]) grow() {
+	if d.buf == nil {
+		d.buf = make([]T, minDequeCap)
+		return
+	}
+	if d.count == len(d.buf) {
+		d.resize(len(d.buf) * 2)
+	}
+}
+
+// shrink halves the ring buffer when it is only a quarter used.
+func (d *Deque[T]) shrink() {
+	if len(d.buf) > minDequeCap && d.count <= len(d.buf)/4 {
+		d.resize(len(d.buf) / 2)
+	}
+}
+
+// resize moves the items into a new ring buffer with the given size, the front
+// item is placed at the beginning of the new buffer.
+func (d *Deque[T]) resize(size int) {
+	buf := make([]T, size)
+	if d.head+d.count <= len(d.buf) {
+		copy(buf, d.buf[d.head:d.head+d.count])
+	} else {
+		n := copy(buf, d.buf[d.head:])
+		copy(buf[n:], d.buf[:d.count-n])
+	}
+	d.buf = buf
+	d.head = 0
+}
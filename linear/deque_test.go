@@ -0,0 +1,131 @@
+package linear
+
+import "testing"
+
+func TestDequePushAndPopAtBothEnds(t *testing.T) {
+	// GIVEN
+	d := NewDeque[int]()
+
+	// WHEN
+	d.PushBack(2)
+	d.PushBack(3)
+	d.PushFront(1)
+	d.PushFront(0)
+
+	// THEN
+	if d.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", d.Len())
+	}
+	for i := 0; i < 4; i++ {
+		if v := d.At(i); v != i {
+			t.Errorf("At(%d) = %d, want %d", i, v, i)
+		}
+	}
+	if v, ok := d.Front(); !ok || v != 0 {
+		t.Errorf("Front() = %d, %v, want 0, true", v, ok)
+	}
+	if v, ok := d.Back(); !ok || v != 3 {
+		t.Errorf("Back() = %d, %v, want 3, true", v, ok)
+	}
+	if v, ok := d.PopFront(); !ok || v != 0 {
+		t.Errorf("PopFront() = %d, %v, want 0, true", v, ok)
+	}
+	if v, ok := d.PopBack(); !ok || v != 3 {
+		t.Errorf("PopBack() = %d, %v, want 3, true", v, ok)
+	}
+	d.PopBack()
+	d.PopBack()
+	if _, ok := d.PopFront(); ok {
+		t.Error("PopFront() should return false")
+	}
+	if _, ok := d.PopBack(); ok {
+		t.Error("PopBack() should return false")
+	}
+	if !d.Empty() {
+		t.Error("Empty() should return true")
+	}
+}
+
+func TestDequeGrowsAndShrinksAcrossWrap(t *testing.T) {
+	// GIVEN
+	var d Deque[int]
+	var model []int
+
+	// WHEN
+	for i := 0; i < 1000; i++ {
+		if i%3 == 0 {
+			d.PushFront(i)
+			model = append([]int{i}, model...)
+		} else {
+			d.PushBack(i)
+			model = append(model, i)
+		}
+	}
+	grown := len(d.buf)
+
+	// THEN
+	for i := range model {
+		if v := d.At(i); v != model[i] {
+			t.Fatalf("At(%d) = %d, want %d", i, v, model[i])
+		}
+	}
+	for len(model) > 10 {
+		if len(model)%2 == 0 {
+			v, _ := d.PopFront()
+			if v != model[0] {
+				t.Fatalf("PopFront() = %d, want %d", v, model[0])
+			}
+			model = model[1:]
+		} else {
+			v, _ := d.PopBack()
+			if v != model[len(model)-1] {
+				t.Fatalf("PopBack() = %d, want %d", v, model[len(model)-1])
+			}
+			model = model[:len(model)-1]
+		}
+	}
+	if len(d.buf) >= grown {
+		t.Errorf("len(buf) = %d, want less than %d", len(d.buf), grown)
+	}
+	for i := range model {
+		if v := d.At(i); v != model[i] {
+			t.Errorf("At(%d) = %d, want %d", i, v, model[i])
+		}
+	}
+}
+
+func TestDequeEach(t *testing.T) {
+	// GIVEN
+	var d Deque[string]
+	d.PushBack("b")
+	d.PushBack("c")
+	d.PushFront("a")
+
+	// WHEN
+	var got []string
+	d.Each(func(i int, item string) bool {
+		got = append(got, item)
+		return i < 1
+	})
+
+	// THEN
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Each() visits %v, want [a b]", got)
+	}
+}
+
+func TestDequeAtOutOfRange(t *testing.T) {
+	// GIVEN
+	var d Deque[int]
+	d.PushBack(1)
+
+	// THEN
+	defer func() {
+		if recover() == nil {
+			t.Error("At(1) should panic")
+		}
+	}()
+
+	// WHEN
+	d.At(1)
+}
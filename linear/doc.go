@@ -0,0 +1,9 @@
+// Package linear implements linear data structures: stacks, queues, deques,
+// heaps, skip lists and bloom filters.
+//
+// Stack used to be a stack of interface{} values, it's now the generic
+// Stack[T]. The old stack is UntypedStack, which NewStack still returns, so
+// code which only calls NewStack and its methods keeps working, but code which
+// names the type Stack must use UntypedStack or switch to Stack[T]. Go doesn't
+// allow an alias to keep both names.
+package linear
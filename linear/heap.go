@@ -0,0 +1,274 @@
+package linear
+
+// Heap is a binary heap ordered by a comparator, the item for which less
+// reports true against all others is at the top, so a less of a < b makes a
+// min heap and a > b makes a max heap. Push and Pop take O(log n) time.
+type Heap[T any] struct {
+	items []T
+	less  func(a, b T) bool
+}
+
+// NewHeap returns a new empty heap ordered by less.
+func NewHeap[T any](less func(a, b T) bool) *Heap[T] {
+	return &Heap[T]{less: less}
+}
+
+// HeapFrom builds a heap ordered by less from the given items in O(n) time,
+// the heap takes the ownership of the slice.
+func HeapFrom[T any](items []T, less func(a, b T) bool) *Heap[T] {
+	h := &Heap[T]{items: items, less: less}
+	for i := len(items)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+	return h
+}
+
+// Len returns the number of items in the heap.
+func (h *Heap[T]) Len() int {
+	return len(h.items)
+}
+
+// Empty returns true if the heap contains no items.
+func (h *Heap[T]) Empty() bool {
+	return len(h.items) == 0
+}
+
+// Push adds an item into the heap.
+func (h *Heap[T]) Push(item T) {
+	h.items = append(h.items, item)
+	h.up(len(h.items) - 1)
+}
+
+// Pop removes and returns the top item of the heap, the second result is false
+// if the heap is empty.
+func (h *Heap[T]) Pop() (T, bool) {
+	var zero T
+	n := len(h.items)
+	if n == 0 {
+		return zero, false
+	}
+	item := h.items[0]
+	h.items[0] = h.items[n-1]
+	h.items[n-1] = zero
+	h.items = h.items[:n-1]
+	h.down(0)
+	return item, true
+}
+
+// Peek returns the top item of the heap without removing it, the second result
+// is false if the heap is empty.
+func (h *Heap[T]) Peek() (T, bool) {
+	if len(h.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return h.items[0], true
+}
+
+// up moves the i-th item up until its parent is not greater than it.
+func (h *Heap[T]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(h.items[i], h.items[parent]) {
+			return
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+// down moves the i-th item down until its children are not less than it.
+func (h *Heap[T]) down(i int) {
+	n := len(h.items)
+	for {
+		smallest := i
+		if l := 2*i + 1; l < n && h.less(h.items[l], h.items[smallest]) {
+			smallest = l
+		}
+		if r := 2*i + 2; r < n && h.less(h.items[r], h.items[smallest]) {
+			smallest = r
+		}
+		if smallest == i {
+			return
+		}
+		h.items[i], h.items[smallest] = h.items[smallest], h.items[i]
+		i = smallest
+	}
+}
+
+// pqEntry is one key with its priority in the indexed priority queue.
+type pqEntry[K comparable, P any] struct {
+	key      K
+	priority P
+}
+
+// IndexedPQ is a priority queue of distinct keys, every key has a priority and
+// the key with the least priority is at the top. Besides Push and Pop, the
+// priority of a key can be changed and a key can be removed in O(log n) time,
+// which is what Dijkstra's and Prim's algorithms need.
+type IndexedPQ[K comparable, P any] struct {
+	entries []pqEntry[K, P]
+	index   map[K]int // position of each key in entries
+	less    func(a, b P) bool
+}
+
+// NewIndexedPQ returns a new empty indexed priority queue ordered by less.
+func NewIndexedPQ[K comparable, P any](less func(a, b P) bool) *IndexedPQ[K, P] {
+	return &IndexedPQ[K, P]{index: make(map[K]int), less: less}
+}
+
+// Len returns the number of keys in the queue.
+func (pq *IndexedPQ[K, P]) Len() int {
+	return len(pq.entries)
+}
+
+// Empty returns true if the queue contains no keys.
+func (pq *IndexedPQ[K, P]) Empty() bool {
+	return len(pq.entries) == 0
+}
+
+// Contains reports whether the key is in the queue.
+func (pq *IndexedPQ[K, P]) Contains(key K) bool {
+	_, ok := pq.index[key]
+	return ok
+}
+
+// Priority returns the priority of the key, the second result is false if the
+// key is not in the queue.
+func (pq *IndexedPQ[K, P]) Priority(key K) (P, bool) {
+	i, ok := pq.index[key]
+	if !ok {
+		var zero P
+		return zero, false
+	}
+	return pq.entries[i].priority, true
+}
+
+// Push adds the key with the priority into the queue, if the key is already in
+// the queue, its priority is updated.
+func (pq *IndexedPQ[K, P]) Push(key K, priority P) {
+	if pq.Update(key, priority) {
+		return
+	}
+	pq.entries = append(pq.entries, pqEntry[K, P]{key: key, priority: priority})
+	pq.index[key] = len(pq.entries) - 1
+	pq.up(len(pq.entries) - 1)
+}
+
+// Update changes the priority of the key in either direction, it returns false
+// if the key is not in the queue.
+func (pq *IndexedPQ[K, P]) Update(key K, priority P) bool {
+	i, ok := pq.index[key]
+	if !ok {
+		return false
+	}
+	pq.entries[i].priority = priority
+	if !pq.up(i) {
+		pq.down(i)
+	}
+	return true
+}
+
+// DecreaseKey lowers the priority of the key, it returns false and keeps the
+// queue unchanged if the key is not in the queue or the new priority is not
+// less than the current one.
+func (pq *IndexedPQ[K, P]) DecreaseKey(key K, priority P) bool {
+	i, ok := pq.index[key]
+	if !ok || !pq.less(priority, pq.entries[i].priority) {
+		return false
+	}
+	pq.entries[i].priority = priority
+	pq.up(i)
+	return true
+}
+
+// Peek returns the key with the least priority without removing it, the last
+// result is false if the queue is empty.
+func (pq *IndexedPQ[K, P]) Peek() (K, P, bool) {
+	if len(pq.entries) == 0 {
+		var key K
+		var priority P
+		return key, priority, false
+	}
+	return pq.entries[0].key, pq.entries[0].priority, true
+}
+
+// Pop removes and returns the key with the least priority, the last result is
+// false if the queue is empty.
+func (pq *IndexedPQ[K, P]) Pop() (K, P, bool) {
+	key, priority, ok := pq.Peek()
+	if ok {
+		pq.removeAt(0)
+	}
+	return key, priority, ok
+}
+
+// Remove removes the key from the queue and returns its priority, the second
+// result is false if the key is not in the queue.
+func (pq *IndexedPQ[K, P]) Remove(key K) (P, bool) {
+	i, ok := pq.index[key]
+	if !ok {
+		var zero P
+		return zero, false
+	}
+	priority := pq.entries[i].priority
+	pq.removeAt(i)
+	return priority, true
+}
+
+// removeAt removes the i-th entry by moving the last entry into its place and
+// fixing the heap order from there.
+func (pq *IndexedPQ[K, P]) removeAt(i int) {
+	last := len(pq.entries) - 1
+	delete(pq.index, pq.entries[i].key)
+	if i != last {
+		pq.entries[i] = pq.entries[last]
+		pq.index[pq.entries[i].key] = i
+	}
+	pq.entries[last] = pqEntry[K, P]{}
+	pq.entries = pq.entries[:last]
+	if i < last && !pq.up(i) {
+		pq.down(i)
+	}
+}
+
+// swap swaps the i-th and j-th entries and keeps the index in sync.
+func (pq *IndexedPQ[K, P]) swap(i, j int) {
+	pq.entries[i], pq.entries[j] = pq.entries[j], pq.entries[i]
+	pq.index[pq.entries[i].key] = i
+	pq.index[pq.entries[j].key] = j
+}
+
+// up moves the i-th entry up until its parent is not greater than it, and
+// reports whether the entry is moved.
+func (pq *IndexedPQ[K, P]) up(i int) bool {
+	start := i
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !pq.less(pq.entries[i].priority, pq.entries[parent].priority) {
+			break
+		}
+		pq.swap(i, parent)
+		i = parent
+	}
+	return i != start
+}
+
+// down moves the i-th entry down until its children are not less than it.
+func (pq *IndexedPQ[K, P]) down(i int) {
+	n := len(pq.entries)
+	for {
+		smallest := i
+		if l := 2*i + 1; l < n && pq.less(pq.entries[l].priority, pq.entries[smallest].priority) {
+			smallest = l
+		}
+		if r := 2*i + 2; r < n && pq.less(pq.entries[r].priority, pq.entries[smallest].priority) {
+			smallest = r
+		}
+		if smallest == i {
+			return
+		}
+		pq.swap(i, smallest)
+		i = smallest
+	}
+}
@@ -0,0 +1,170 @@
+package linear
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestMinHeap(t *testing.T) {
+	// GIVEN
+	h := NewHeap(func(a, b int) bool { return a < b })
+	items := rand.Perm(200)
+
+	// WHEN
+	for _, v := range items {
+		h.Push(v)
+	}
+
+	// THEN
+	if v, ok := h.Peek(); !ok || v != 0 {
+		t.Errorf("Peek() = %d, %v, want 0, true", v, ok)
+	}
+	for want := 0; want < 200; want++ {
+		if v, ok := h.Pop(); !ok || v != want {
+			t.Fatalf("Pop() = %d, %v, want %d, true", v, ok, want)
+		}
+	}
+	if _, ok := h.Pop(); ok {
+		t.Error("Pop() should return false")
+	}
+}
+
+func TestTopKWithHeapFrom(t *testing.T) {
+	// GIVEN
+	items := []string{"pear", "apple", "fig", "kiwi", "banana", "cherry"}
+
+	// WHEN
+	h := HeapFrom(append([]string(nil), items...), func(a, b string) bool { return a > b })
+	var top []string
+	for i := 0; i < 3; i++ {
+		v, _ := h.Pop()
+		top = append(top, v)
+	}
+
+	// THEN
+	sort.Sort(sort.Reverse(sort.StringSlice(items)))
+	for i := range top {
+		if top[i] != items[i] {
+			t.Errorf("top = %v, want %v", top, items[:3])
+			break
+		}
+	}
+}
+
+func TestIndexedPQ(t *testing.T) {
+	// GIVEN
+	pq := NewIndexedPQ[string](func(a, b int) bool { return a < b })
+	pq.Push("a", 5)
+	pq.Push("b", 3)
+	pq.Push("c", 8)
+	pq.Push("d", 1)
+
+	// WHEN
+	decreased := pq.DecreaseKey("c", 2)
+	notDecreased := pq.DecreaseKey("a", 7)
+	pq.Update("d", 10)
+	removed, ok := pq.Remove("b")
+
+	// THEN
+	if !decreased || notDecreased {
+		t.Errorf("DecreaseKey() = %v, %v, want true, false", decreased, notDecreased)
+	}
+	if !ok || removed != 3 {
+		t.Errorf("Remove(b) = %d, %v, want 3, true", removed, ok)
+	}
+	if pq.Contains("b") || !pq.Contains("a") {
+		t.Error("Contains() should reflect removed keys")
+	}
+	if p, _ := pq.Priority("a"); p != 5 {
+		t.Errorf("Priority(a) = %d, want 5", p)
+	}
+	want := []string{"c", "a", "d"}
+	for _, w := range want {
+		if k, _, ok := pq.Pop(); !ok || k != w {
+			t.Errorf("Pop() = %q, %v, want %q, true", k, ok, w)
+		}
+	}
+	if _, _, ok := pq.Pop(); ok {
+		t.Error("Pop() should return false")
+	}
+}
+
+func TestIndexedPQRandomOperations(t *testing.T) {
+	// GIVEN
+	r := rand.New(rand.NewSource(1))
+	pq := NewIndexedPQ[int](func(a, b int) bool { return a < b })
+	model := make(map[int]int)
+
+	// WHEN
+	for i := 0; i < 5000; i++ {
+		k := r.Intn(100)
+		switch r.Intn(4) {
+		case 0, 1:
+			p := r.Intn(1000)
+			pq.Push(k, p)
+			model[k] = p
+		case 2:
+			_, ok := pq.Remove(k)
+			if _, exist := model[k]; ok != exist {
+				t.Fatalf("Remove(%d) = %v, want %v", k, ok, exist)
+			}
+			delete(model, k)
+		case 3:
+			k, p, ok := pq.Pop()
+			if !ok {
+				if len(model) != 0 {
+					t.Fatal("Pop() should return true")
+				}
+				continue
+			}
+			for mk, mp := range model {
+				if mp < p {
+					t.Fatalf("Pop() = %d with %d, but %d has %d", k, p, mk, mp)
+				}
+			}
+			delete(model, k)
+		}
+
+		// THEN
+		if pq.Len() != len(model) {
+			t.Fatalf("Len() = %d, want %d", pq.Len(), len(model))
+		}
+	}
+}
+
+// TestDijkstraWithIndexedPQ tests the indexed priority queue in the shortest
+// path algorithm, which replaces the O(V) scan of the shortest vertex.
+func TestDijkstraWithIndexedPQ(t *testing.T) {
+	// GIVEN
+	edges := map[int][][2]int{
+		0: {{1, 4}, {2, 1}},
+		2: {{1, 2}, {3, 5}},
+		1: {{3, 1}},
+	}
+	dist := map[int]int{0: 0}
+	pq := NewIndexedPQ[int](func(a, b int) bool { return a < b })
+	pq.Push(0, 0)
+
+	// WHEN
+	for !pq.Empty() {
+		v, d, _ := pq.Pop()
+		for _, e := range edges[v] {
+			w, nd := e[0], d+e[1]
+			if old, ok := dist[w]; !ok || nd < old {
+				dist[w] = nd
+				if !pq.DecreaseKey(w, nd) {
+					pq.Push(w, nd)
+				}
+			}
+		}
+	}
+
+	// THEN
+	want := map[int]int{0: 0, 1: 3, 2: 1, 3: 4}
+	for v, d := range want {
+		if dist[v] != d {
+			t.Errorf("dist[%d] = %d, want %d", v, dist[v], d)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package linear
+
+// Queue is a linear data structure which follows the FIFO(First In First Out)
+// order, it's a facade of Deque which only pushes at the back and pops at the
+// front. The zero value is an empty queue ready to use.
+type Queue[T any] struct {
+	items Deque[T]
+}
+
+// NewQueue returns a new empty queue.
+func NewQueue[T any]() *Queue[T] {
+	return &Queue[T]{}
+}
+
+// Enqueue adds an item to the back of the queue.
+func (q *Queue[T]) Enqueue(item T) {
+	q.items.PushBack(item)
+}
+
+// Dequeue removes and returns the item at the front of the queue, the second
+// result is false if the queue is empty.
+func (q *Queue[T]) Dequeue() (T, bool) {
+	return q.items.PopFront()
+}
+
+// Peek returns the item at the front of the queue without removing it, the
+// second result is false if the queue is empty.
+func (q *Queue[T]) Peek() (T, bool) {
+	return q.items.Front()
+}
+
+// Len returns the number of items in the queue.
+func (q *Queue[T]) Len() int {
+	return q.items.Len()
+}
+
+// Empty returns true if the queue contains no items.
+func (q *Queue[T]) Empty() bool {
+	return q.items.Empty()
+}
+
+// Each calls f for every item from the front to the back of the queue, the
+// iteration stops when f returns false.
+func (q *Queue[T]) Each(f func(i int, item T) bool) {
+	q.items.Each(f)
+}
+
+// Clear removes all items from the queue.
+func (q *Queue[T]) Clear() {
+	q.items.Clear()
+}
@@ -0,0 +1,32 @@
+package linear
+
+import "testing"
+
+func TestQueue(t *testing.T) {
+	// GIVEN
+	q := NewQueue[int]()
+
+	// WHEN
+	for i := 1; i <= 100; i++ {
+		q.Enqueue(i)
+	}
+
+	// THEN
+	if q.Len() != 100 {
+		t.Errorf("Len() = %d, want 100", q.Len())
+	}
+	if v, ok := q.Peek(); !ok || v != 1 {
+		t.Errorf("Peek() = %d, %v, want 1, true", v, ok)
+	}
+	for want := 1; want <= 100; want++ {
+		if v, ok := q.Dequeue(); !ok || v != want {
+			t.Fatalf("Dequeue() = %d, %v, want %d, true", v, ok, want)
+		}
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Dequeue() should return false")
+	}
+	if !q.Empty() {
+		t.Error("Empty() should return true")
+	}
+}
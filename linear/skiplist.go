@@ -21,12 +21,22 @@ type SLNode[T constraints.Ordered] struct {
 	// dicision maker for inserting at next level, default is RandomDicisionMaker,
 	// which is global shared for head node, can be set by SetDicisionMaker method.
 	dm DicisionMaker
+	// ttl records the deadlines of keys inserted by InsertWithTTL, which is
+	// global shared for head node like dm.
+	ttl *ttlIndex[T]
 }
 
 // NewSkipList returns a new skip list with the given key and value as the head
 // node of the top level.
 func NewSkipList[T constraints.Ordered](key T, value interface{}) *SLNode[T] {
-	return &SLNode[T]{key: key, value: value, right: nil, down: nil, dm: &RandomDicisionMaker{}}
+	return &SLNode[T]{
+		key:   key,
+		value: value,
+		right: nil,
+		down:  nil,
+		dm:    &RandomDicisionMaker{},
+		ttl:   newTTLIndex[T](),
+	}
 }
 
 // SetDicisionMaker sets the dicision maker for the skip list, the dicision
@@ -37,29 +47,44 @@ func (head *SLNode[T]) SetDicisionMaker(dm DicisionMaker) {
 }
 
 // Search searches the target key in the skip list, if the key is found, the
-// value of the node is returned, otherwise nil is returned.
+// value of the node is returned, otherwise nil is returned. A key whose TTL
+// has passed is deleted lazily and treated as not found.
 func (head *SLNode[T]) Search(key T) interface{} {
+	if head.expire(key) {
+		return nil
+	}
+	value, _ := head.search(key)
+	return value
+}
+
+// search searches the target key in the skip list without checking the TTL,
+// the second result reports whether the key is found.
+func (head *SLNode[T]) search(key T) (interface{}, bool) {
 	if head != nil && key == head.key {
-		return head.value
+		return head.value, true
 	}
 	p := head
 	for p != nil {
 		if p.right == nil || p.right.key > key {
 			p = p.down
 		} else if p.right.key == key {
-			return p.right.value
+			return p.right.value, true
 		} else {
 			p = p.right
 		}
 	}
-	return nil
+	return nil, false
 }
 
 // Insert inserts the key and value into the skip list when the key is not in
-// the skip list, otherwise updates the value of the key.
+// the skip list, otherwise updates the value of the key. The key never expires
+// after Insert, even if it had a TTL.
 func (head *SLNode[T]) Insert(key T, value interface{}) *SLNode[T] {
+	if !head.expire(key) && head.ttl != nil {
+		head.ttl.remove(key)
+	}
 	// trace the path when searching the key
-	path := NewStack()
+	var path Stack[*SLNode[T]]
 	p := head
 	for p != nil {
 		for p.right != nil && p.right.key < key {
@@ -71,7 +96,7 @@ func (head *SLNode[T]) Insert(key T, value interface{}) *SLNode[T] {
 	var down *SLNode[T]
 	shouldInsert := true
 	for shouldInsert && !path.Empty() {
-		insert, _ := path.Pop().(*SLNode[T])
+		insert, _ := path.Pop()
 		insert.right = &SLNode[T]{key: key, value: value, right: insert.right, down: down}
 		// record for next iteration
 		down = insert.right
@@ -83,7 +108,7 @@ func (head *SLNode[T]) Insert(key T, value interface{}) *SLNode[T] {
 		// create the new right node at the most top level
 		right := &SLNode[T]{key: key, value: value, right: nil, down: down}
 		// create the new head node at the most top level
-		head = &SLNode[T]{key: head.key, value: head.value, right: right, down: head, dm: head.dm}
+		head = &SLNode[T]{key: head.key, value: head.value, right: right, down: head, dm: head.dm, ttl: head.ttl}
 	}
 	return head
 }
@@ -91,29 +116,29 @@ func (head *SLNode[T]) Insert(key T, value interface{}) *SLNode[T] {
 // Update updates the value of the key in the skip list, if the key is not in
 // the skip list, nothing happens.
 func (head *SLNode[T]) Update(key T, value interface{}) {
-	if head.Search(key) == nil {
+	if head.expire(key) {
 		return
 	}
 	p := head
-	h := head
 	for p != nil {
-		if p.right == nil {
-			h = h.down
-			p = h
-		} else {
-			if p.key == key {
-				p.value = value
-				p = p.down
-			} else {
-				p = p.right
-			}
+		for p.right != nil && p.right.key < key {
+			p = p.right
+		}
+		if p.key == key {
+			p.value = value
+		} else if p.right != nil && p.right.key == key {
+			p.right.value = value
 		}
+		p = p.down
 	}
 }
 
 // Delete deletes the key from the skip list, if the key is not in the skip list,
 // nothing happens.
 func (head *SLNode[T]) Delete(key T) {
+	if head.ttl != nil {
+		head.ttl.remove(key)
+	}
 	p := head
 	for p != nil {
 		for p.right != nil && p.right.key < key {
@@ -13,7 +13,7 @@ func (m *mockDicisionMaker) ShouldInsert() bool {
 func TestCreateSkipListNode(t *testing.T) {
 	head := NewSkipList(1, "a")
 	if head.key != 1 || head.value != "a" || head.right != nil || head.down != nil {
-		t.Errorf("NewSkipList(1, \"a\") = %v, want %v", head, SLNode[int]{1, "a", nil, nil, &RandomDicisionMaker{}})
+		t.Errorf("NewSkipList(1, \"a\") = %v, want %v", head, SLNode[int]{key: 1, value: "a", dm: &RandomDicisionMaker{}})
 	}
 }
 
@@ -87,6 +87,29 @@ func TestUpdateSkipListHeadNode(t *testing.T) {
 
 }
 
+func TestUpdateSkipListLastNode(t *testing.T) {
+	// GIVEN
+	head := NewSkipList(1, "a")
+	head.SetDicisionMaker(&mockDicisionMaker{true})
+	head = head.Insert(2, "b")
+	head = head.Insert(3, "c")
+
+	// WHEN
+	head.Update(3, "d")
+
+	// THEN
+	if head.Search(3) != "d" {
+		t.Errorf("head.Search(3) = %v, want \"d\"", head.Search(3))
+	}
+	for h := head; h != nil; h = h.down {
+		for p := h; p != nil; p = p.right {
+			if p.key == 3 && p.value != "d" {
+				t.Errorf("p.value = %v, want \"d\"", p.value)
+			}
+		}
+	}
+}
+
 func TestInsertWithMockDicisionMaker(t *testing.T) {
 	// GIVEN
 	head := NewSkipList(1, "a")
@@ -141,7 +164,9 @@ func TestInsertWithMockDicisionMaker(t *testing.T) {
 
 func TestDeleteSkipListNode(t *testing.T) {
 	// GIVEN
+	// every key is inserted at all levels, so head.right is never nil
 	head := NewSkipList(1, "a")
+	head.SetDicisionMaker(&mockDicisionMaker{true})
 	head = head.Insert(2, "b")
 	head = head.Insert(3, "c")
 	head = head.Insert(4, "d")
@@ -0,0 +1,160 @@
+package linear
+
+import (
+	"container/heap"
+	"time"
+
+	"golang.org/x/exp/constraints"
+)
+
+// Clock is the interface for telling the current time, the skip list uses it
+// to decide whether a key inserted by InsertWithTTL is expired or not.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the default clock, it returns the wall clock time.
+type SystemClock struct{}
+
+// Now implements the Now method of Clock interface.
+func (c *SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock sets the clock for the skip list, the clock is used to check the
+// TTL of keys when searching, updating and inserting.
+func (head *SLNode[T]) SetClock(c Clock) {
+	head.deadlines().clock = c
+}
+
+// InsertWithTTL inserts the key and value into the skip list like Insert, and
+// the key expires after ttl. Inserting an existing key updates its value and
+// resets its deadline. The key of head node is the anchor of the skip list and
+// never expires, so only its value is updated.
+func (head *SLNode[T]) InsertWithTTL(key T, value interface{}, ttl time.Duration) *SLNode[T] {
+	if key == head.key {
+		head.Update(key, value)
+		return head
+	}
+	idx := head.deadlines()
+	head.expire(key)
+	if _, ok := head.search(key); ok {
+		head.Update(key, value)
+	} else {
+		head = head.Insert(key, value)
+	}
+	idx.set(key, idx.clock.Now().Add(ttl))
+	return head
+}
+
+// Sweep deletes all keys whose deadline is not after now from the skip list,
+// the deleted keys are returned in the order of their deadlines, keys with the
+// same deadline are ordered by key.
+func (head *SLNode[T]) Sweep(now time.Time) []T {
+	var keys []T
+	for head.ttl != nil && len(head.ttl.queue) > 0 && !head.ttl.queue[0].deadline.After(now) {
+		key := head.ttl.queue[0].key
+		head.Delete(key)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// deadlines returns the TTL index of the skip list, it's created with the
+// system clock if the head node wasn't made by NewSkipList.
+func (head *SLNode[T]) deadlines() *ttlIndex[T] {
+	if head.ttl == nil {
+		head.ttl = newTTLIndex[T]()
+	}
+	return head.ttl
+}
+
+// expire deletes the key from the skip list if its TTL has passed, and reports
+// whether the key is deleted.
+func (head *SLNode[T]) expire(key T) bool {
+	if head == nil || head.ttl == nil {
+		return false
+	}
+	e, ok := head.ttl.entries[key]
+	if !ok || head.ttl.clock.Now().Before(e.deadline) {
+		return false
+	}
+	head.Delete(key)
+	return true
+}
+
+// ttlEntry is the deadline of one key, index is the position in the queue.
+type ttlEntry[T constraints.Ordered] struct {
+	key      T
+	deadline time.Time
+	index    int
+}
+
+// ttlQueue is a min heap of entries ordered by deadline and then by key, it's
+// the secondary ordering used by Sweep.
+type ttlQueue[T constraints.Ordered] []*ttlEntry[T]
+
+func (q ttlQueue[T]) Len() int { return len(q) }
+
+func (q ttlQueue[T]) Less(i, j int) bool {
+	if q[i].deadline.Equal(q[j].deadline) {
+		return q[i].key < q[j].key
+	}
+	return q[i].deadline.Before(q[j].deadline)
+}
+
+func (q ttlQueue[T]) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *ttlQueue[T]) Push(x interface{}) {
+	e := x.(*ttlEntry[T])
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *ttlQueue[T]) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return e
+}
+
+// ttlIndex records the deadlines of keys, entries is used to find the entry
+// of a key, and queue is used to find the earliest deadline.
+type ttlIndex[T constraints.Ordered] struct {
+	clock   Clock
+	entries map[T]*ttlEntry[T]
+	queue   ttlQueue[T]
+}
+
+// newTTLIndex returns an empty TTL index with the system clock.
+func newTTLIndex[T constraints.Ordered]() *ttlIndex[T] {
+	return &ttlIndex[T]{clock: &SystemClock{}, entries: make(map[T]*ttlEntry[T])}
+}
+
+// set sets or resets the deadline of the key.
+func (idx *ttlIndex[T]) set(key T, deadline time.Time) {
+	if e, ok := idx.entries[key]; ok {
+		e.deadline = deadline
+		heap.Fix(&idx.queue, e.index)
+		return
+	}
+	e := &ttlEntry[T]{key: key, deadline: deadline}
+	idx.entries[key] = e
+	heap.Push(&idx.queue, e)
+}
+
+// remove removes the deadline of the key if it has one.
+func (idx *ttlIndex[T]) remove(key T) {
+	e, ok := idx.entries[key]
+	if !ok {
+		return
+	}
+	delete(idx.entries, key)
+	heap.Remove(&idx.queue, e.index)
+}
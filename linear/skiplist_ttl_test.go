@@ -0,0 +1,208 @@
+package linear
+
+import (
+	"testing"
+	"time"
+)
+
+type mockClock struct {
+	now time.Time
+}
+
+func (m *mockClock) Now() time.Time {
+	return m.now
+}
+
+func (m *mockClock) advance(d time.Duration) {
+	m.now = m.now.Add(d)
+}
+
+func newTTLSkipList() (*SLNode[int], *mockClock) {
+	clock := &mockClock{now: time.Unix(1000, 0)}
+	head := NewSkipList(0, "head")
+	head.SetClock(clock)
+	return head, clock
+}
+
+func TestInsertWithTTLExpiresLazily(t *testing.T) {
+	// GIVEN
+	head, clock := newTTLSkipList()
+	head = head.InsertWithTTL(1, "a", time.Second)
+	head = head.InsertWithTTL(2, "b", 3*time.Second)
+	head = head.Insert(3, "c")
+
+	// WHEN
+	clock.advance(2 * time.Second)
+
+	// THEN
+	if v := head.Search(1); v != nil {
+		t.Errorf("head.Search(1) = %v, want nil", v)
+	}
+	if v := head.Search(2); v != "b" {
+		t.Errorf("head.Search(2) = %v, want \"b\"", v)
+	}
+	if v := head.Search(3); v != "c" {
+		t.Errorf("head.Search(3) = %v, want \"c\"", v)
+	}
+	if _, ok := head.search(1); ok {
+		t.Error("key 1 should be deleted after it expired")
+	}
+	if _, ok := head.ttl.entries[1]; ok {
+		t.Error("deadline of key 1 should be removed")
+	}
+}
+
+func TestInsertWithTTLResetsDeadline(t *testing.T) {
+	// GIVEN
+	head, clock := newTTLSkipList()
+	head = head.InsertWithTTL(1, "a", time.Second)
+	clock.advance(500 * time.Millisecond)
+
+	// WHEN
+	head = head.InsertWithTTL(1, "b", time.Second)
+	clock.advance(700 * time.Millisecond)
+
+	// THEN
+	if v := head.Search(1); v != "b" {
+		t.Errorf("head.Search(1) = %v, want \"b\"", v)
+	}
+	clock.advance(300 * time.Millisecond)
+	if v := head.Search(1); v != nil {
+		t.Errorf("head.Search(1) = %v, want nil", v)
+	}
+}
+
+func TestUpdateExpiredKey(t *testing.T) {
+	// GIVEN
+	head, clock := newTTLSkipList()
+	head = head.InsertWithTTL(1, "a", time.Second)
+	clock.advance(time.Second)
+
+	// WHEN
+	head.Update(1, "b")
+
+	// THEN
+	if v := head.Search(1); v != nil {
+		t.Errorf("head.Search(1) = %v, want nil", v)
+	}
+}
+
+func TestInsertExpiredKeyAgain(t *testing.T) {
+	// GIVEN
+	head, clock := newTTLSkipList()
+	head = head.InsertWithTTL(1, "a", time.Second)
+	clock.advance(time.Second)
+
+	// WHEN
+	head = head.Insert(1, "b")
+	clock.advance(time.Hour)
+
+	// THEN
+	if v := head.Search(1); v != "b" {
+		t.Errorf("head.Search(1) = %v, want \"b\"", v)
+	}
+}
+
+func TestInsertLiveKeyClearsDeadline(t *testing.T) {
+	// GIVEN
+	head, clock := newTTLSkipList()
+	head.SetDicisionMaker(&mockDicisionMaker{false})
+	head = head.InsertWithTTL(1, "a", time.Second)
+
+	// WHEN
+	head = head.Insert(1, "b")
+	clock.advance(time.Hour)
+
+	// THEN
+	if v := head.Search(1); v != "b" {
+		t.Errorf("head.Search(1) = %v, want \"b\"", v)
+	}
+	if keys := head.Sweep(clock.Now()); len(keys) != 0 {
+		t.Errorf("head.Sweep() = %v, want empty", keys)
+	}
+}
+
+func TestHeadKeyNeverExpires(t *testing.T) {
+	// GIVEN
+	head, clock := newTTLSkipList()
+
+	// WHEN
+	head = head.InsertWithTTL(0, "new head", time.Second)
+	clock.advance(time.Hour)
+
+	// THEN
+	if v := head.Search(0); v != "new head" {
+		t.Errorf("head.Search(0) = %v, want \"new head\"", v)
+	}
+}
+
+func TestSweepInDeadlineOrder(t *testing.T) {
+	// GIVEN
+	head, clock := newTTLSkipList()
+	head.SetDicisionMaker(&mockDicisionMaker{true})
+	head = head.InsertWithTTL(5, "e", 3*time.Second)
+	head = head.InsertWithTTL(1, "a", 2*time.Second)
+	head = head.InsertWithTTL(4, "d", time.Second)
+	head = head.InsertWithTTL(2, "b", 2*time.Second)
+	head = head.InsertWithTTL(3, "c", 10*time.Second)
+	head = head.Insert(6, "f")
+
+	// WHEN
+	keys := head.Sweep(clock.Now().Add(3 * time.Second))
+
+	// THEN
+	want := []int{4, 1, 2, 5}
+	if len(keys) != len(want) {
+		t.Fatalf("head.Sweep() = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("head.Sweep() = %v, want %v", keys, want)
+			break
+		}
+	}
+	for p := head; p != nil; p = p.down {
+		for q := p.right; q != nil; q = q.right {
+			if q.key != 3 && q.key != 6 {
+				t.Errorf("key %v should be swept at every level", q.key)
+			}
+		}
+	}
+	if len(head.ttl.queue) != 1 {
+		t.Errorf("len(head.ttl.queue) = %v, want 1", len(head.ttl.queue))
+	}
+}
+
+func TestDeleteRemovesDeadline(t *testing.T) {
+	// GIVEN
+	head, clock := newTTLSkipList()
+	head = head.InsertWithTTL(1, "a", time.Second)
+
+	// WHEN
+	head.Delete(1)
+
+	// THEN
+	if keys := head.Sweep(clock.Now().Add(time.Hour)); len(keys) != 0 {
+		t.Errorf("head.Sweep() = %v, want empty", keys)
+	}
+}
+
+func TestTTLWithoutNewSkipList(t *testing.T) {
+	// GIVEN
+	clock := &mockClock{now: time.Unix(1000, 0)}
+	head := &SLNode[int]{value: "head"}
+	head.SetDicisionMaker(&mockDicisionMaker{false})
+
+	// WHEN
+	head.SetClock(clock)
+	head = head.InsertWithTTL(1, "a", time.Second)
+	clock.advance(time.Second)
+
+	// THEN
+	if v := head.Search(1); v != nil {
+		t.Errorf("head.Search(1) = %v, want nil", v)
+	}
+	if keys := (&SLNode[int]{}).Sweep(clock.Now()); len(keys) != 0 {
+		t.Errorf("Sweep() = %v, want empty", keys)
+	}
+}
@@ -1,27 +1,116 @@
 package linear
 
+import "errors"
+
+// ErrFull is returned when pushing an item into a container which has reached
+// its maximum capacity.
+var ErrFull = errors.New("linear: container is full")
+
+// minShrinkCap is the capacity under which the backing slice of a stack is
+// never shrunk, small slices are cheap to keep.
+const minShrinkCap = 16
+
 // Stack is a linear data structure which follows a particular order in which
 // the operations are performed. The order may be LIFO(Last In First Out) or
-// FILO(First In Last Out).
-type Stack struct {
+// FILO(First In Last Out). The zero value is an empty stack without maximum
+// capacity, use NewBoundedStack to limit the number of items.
+type Stack[T any] struct {
+	items []T
+	limit int // maximum number of items, 0 means unlimited
+}
+
+// NewBoundedStack returns a new stack which holds at most capacity items,
+// pushing more items returns ErrFull. A capacity <= 0 means unlimited.
+func NewBoundedStack[T any](capacity int) *Stack[T] {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &Stack[T]{limit: capacity}
+}
+
+// Push pushes an item onto the top of this stack, it returns ErrFull when the
+// stack has reached its maximum capacity.
+func (s *Stack[T]) Push(item T) error {
+	if s.limit > 0 && len(s.items) >= s.limit {
+		return ErrFull
+	}
+	s.items = append(s.items, item)
+	return nil
+}
+
+// Pop removes the item at the top of this stack and returns it, the second
+// result is false if the stack is empty. The backing slice is shrunk when most
+// of it is unused after popping.
+func (s *Stack[T]) Pop() (T, bool) {
+	var zero T
+	n := len(s.items)
+	if n == 0 {
+		return zero, false
+	}
+	item := s.items[n-1]
+	// clear the slot so that the item can be garbage collected
+	s.items[n-1] = zero
+	s.items = s.items[:n-1]
+	if c := cap(s.items); c > minShrinkCap && len(s.items) <= c/4 {
+		items := make([]T, len(s.items), c/2)
+		copy(items, s.items)
+		s.items = items
+	}
+	return item, true
+}
+
+// Peek returns the item at the top of this stack without removing it, the
+// second result is false if the stack is empty.
+func (s *Stack[T]) Peek() (T, bool) {
+	if len(s.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return s.items[len(s.items)-1], true
+}
+
+// Len returns the number of items in this stack.
+func (s *Stack[T]) Len() int {
+	return len(s.items)
+}
+
+// Empty returns true if this stack contains no items.
+func (s *Stack[T]) Empty() bool {
+	return len(s.items) == 0
+}
+
+// Clear removes all items from this stack and releases the backing slice.
+func (s *Stack[T]) Clear() {
+	s.items = nil
+}
+
+// UntypedStack is the stack which holds items of any type, it was named Stack
+// before Stack became generic.
+//
+// Deprecated: Use Stack[T] instead.
+type UntypedStack struct {
 	top   interface{}
 	items []interface{}
 }
 
-// NewStack returns a new stack.
-func NewStack() *Stack {
-	return &Stack{top: nil, items: make([]interface{}, 0)}
+// NewStack returns a new untyped stack, it returned *Stack before Stack became
+// generic.
+//
+// Deprecated: Use a Stack[T], whose zero value is an empty stack, or
+// NewBoundedStack instead.
+func NewStack() *UntypedStack {
+	return &UntypedStack{top: nil, items: make([]interface{}, 0)}
 }
 
 // Push pushes an item onto the top of this stack.
-func (s *Stack) Push(item interface{}) {
+func (s *UntypedStack) Push(item interface{}) {
 	s.items = append(s.items, item)
 	s.top = item
 }
 
 // Pop removes the object at the top of this stack and returns that object as
 // the value of this function. If the stack is empty, the function returns nil.
-func (s *Stack) Pop() interface{} {
+func (s *UntypedStack) Pop() interface{} {
 	if len(s.items) == 0 {
 		return nil
 	}
@@ -37,11 +126,11 @@ func (s *Stack) Pop() interface{} {
 
 // Top returns the object at the top of this stack without removing it from the
 // stack. If the stack is empty, the function returns nil.
-func (s *Stack) Top() interface{} {
+func (s *UntypedStack) Top() interface{} {
 	return s.top
 }
 
 // Empty returns true if this stack contains no elements.
-func (s *Stack) Empty() bool {
+func (s *UntypedStack) Empty() bool {
 	return len(s.items) == 0
 }
@@ -40,3 +40,100 @@ func TestStack(t *testing.T) {
 		t.Error("Empty() should return true")
 	}
 }
+
+func TestGenericStack(t *testing.T) {
+	// GIVEN
+	var stack Stack[int]
+
+	// WHEN
+	for i := 1; i <= 3; i++ {
+		if err := stack.Push(i); err != nil {
+			t.Fatalf("Push(%d) = %v, want nil", i, err)
+		}
+	}
+
+	// THEN
+	if stack.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", stack.Len())
+	}
+	if v, ok := stack.Peek(); !ok || v != 3 {
+		t.Errorf("Peek() = %d, %v, want 3, true", v, ok)
+	}
+	for want := 3; want >= 1; want-- {
+		if v, ok := stack.Pop(); !ok || v != want {
+			t.Errorf("Pop() = %d, %v, want %d, true", v, ok, want)
+		}
+	}
+	if v, ok := stack.Pop(); ok || v != 0 {
+		t.Errorf("Pop() = %d, %v, want 0, false", v, ok)
+	}
+	if _, ok := stack.Peek(); ok {
+		t.Error("Peek() should return false")
+	}
+	if !stack.Empty() {
+		t.Error("Empty() should return true")
+	}
+}
+
+func TestBoundedStack(t *testing.T) {
+	// GIVEN
+	stack := NewBoundedStack[string](2)
+	stack.Push("a")
+	stack.Push("b")
+
+	// WHEN
+	err := stack.Push("c")
+
+	// THEN
+	if err != ErrFull {
+		t.Errorf("Push() = %v, want ErrFull", err)
+	}
+	if v, _ := stack.Peek(); v != "b" {
+		t.Errorf("Peek() = %q, want \"b\"", v)
+	}
+	stack.Pop()
+	if err := stack.Push("c"); err != nil {
+		t.Errorf("Push() = %v, want nil", err)
+	}
+}
+
+func TestStackShrinksAfterPops(t *testing.T) {
+	// GIVEN
+	var stack Stack[int]
+	for i := 0; i < 1024; i++ {
+		stack.Push(i)
+	}
+	grown := cap(stack.items)
+
+	// WHEN
+	for i := 0; i < 1020; i++ {
+		stack.Pop()
+	}
+
+	// THEN
+	if cap(stack.items) >= grown/4 {
+		t.Errorf("cap(items) = %d, want less than %d", cap(stack.items), grown/4)
+	}
+	for want := 3; want >= 0; want-- {
+		if v, _ := stack.Pop(); v != want {
+			t.Errorf("Pop() = %d, want %d", v, want)
+		}
+	}
+}
+
+func TestClearStack(t *testing.T) {
+	// GIVEN
+	stack := NewBoundedStack[int](1)
+	stack.Push(1)
+
+	// WHEN
+	stack.Clear()
+
+	// THEN
+	if stack.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", stack.Len())
+	}
+	if err := stack.Push(2); err != nil {
+		t.Errorf("Push() = %v, want nil", err)
+	}
+}
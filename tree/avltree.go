@@ -3,101 +3,145 @@ package tree
 import (
 	"fmt"
 
+	"github.com/wangwalker/dsal/linear"
 	"golang.org/x/exp/constraints"
 )
 
-// AVLNode is the node of the AVL tree.
-type AVLNode[T constraints.Ordered] struct {
+// AVLNode is the node of the AVL tree, V is the type of values. The tree
+// works as an ordered set with struct{} values, which are the nodes made by
+// NewAVLNode, and AVLTree uses it as an ordered map. Count is the number of occurrences of the key, which is always
+// 1 unless the tree is used as a multiset by AVLMultiset. Size is the number
+// of occurrences of all keys in the subtree, which makes order statistics such
+// as Rank and Select take O(log n) time.
+type AVLNode[T constraints.Ordered, V any] struct {
 	key   T
+	value V
 	level int
-	left  *AVLNode[T]
-	right *AVLNode[T]
+	count int
+	size  int
+	left  *AVLNode[T, V]
+	right *AVLNode[T, V]
 }
 
 // height returns the level of the AVL tree when node is not nil.
-func (tree *AVLNode[T]) height() int {
+func (tree *AVLNode[T, V]) height() int {
 	if tree == nil {
 		return 0
 	}
 	return tree.level
 }
 
-// NewAVLNode creates a new AVL node.
-func NewAVLNode[T constraints.Ordered](k T) *AVLNode[T] {
-	return &AVLNode[T]{key: k, level: 1}
+// len returns the size of the AVL tree when node is not nil.
+func (tree *AVLNode[T, V]) len() int {
+	if tree == nil {
+		return 0
+	}
+	return tree.size
+}
+
+// update recalculates the level and size of the node from its children.
+func (tree *AVLNode[T, V]) update() {
+	tree.level = max(tree.left.height(), tree.right.height()) + 1
+	tree.size = tree.left.len() + tree.right.len() + tree.count
+}
+
+// NewAVLNode creates a new AVL node of an ordered set.
+func NewAVLNode[T constraints.Ordered](k T) *AVLNode[T, struct{}] {
+	return newAVLNode[T, struct{}](k)
+}
+
+// newAVLNode creates a new AVL node with the zero value.
+func newAVLNode[T constraints.Ordered, V any](k T) *AVLNode[T, V] {
+	return &AVLNode[T, V]{key: k, level: 1, count: 1, size: 1}
 }
 
-// Insert inserts a key into the AVL tree.
-func (tree *AVLNode[T]) Insert(k T) *AVLNode[T] {
+// Insert inserts a key into the AVL tree. If the key is already in the tree,
+// nothing happens.
+func (tree *AVLNode[T, V]) Insert(k T) *AVLNode[T, V] {
+	var zero V
+	tree, _ = tree.put(k, zero, false)
+	return tree
+}
+
+// put inserts a key with its value into the AVL tree, if the key is already in
+// the tree, its value is replaced only when replace is true. It returns the
+// new root and whether a new node is inserted.
+func (tree *AVLNode[T, V]) put(k T, v V, replace bool) (*AVLNode[T, V], bool) {
 	if tree == nil {
-		return NewAVLNode(k)
+		node := newAVLNode[T, V](k)
+		node.value = v
+		return node, true
 	}
+	var inserted bool
 	if k < tree.key {
-		tree.left = tree.left.Insert(k)
+		tree.left, inserted = tree.left.put(k, v, replace)
 	} else if k > tree.key {
-		tree.right = tree.right.Insert(k)
+		tree.right, inserted = tree.right.put(k, v, replace)
 	} else {
-		return tree
-	}
-	// rebalance the tree
-	tree.level = max(tree.left.height(), tree.right.height()) + 1
-	balance := tree.left.height() - tree.right.height()
-	if balance > 1 {
-		// left-left case
-		if k < tree.left.key {
-			return tree.rightRotate()
-		} else {
-			// left-right case
-			tree.left = tree.left.leftRotate()
-			return tree.rightRotate()
-		}
-	} else if balance < -1 {
-		// right-right case
-		if k > tree.right.key {
-			return tree.leftRotate()
-		} else {
-			// right-left case
-			tree.right = tree.right.rightRotate()
-			return tree.leftRotate()
+		if replace {
+			tree.value = v
 		}
+		return tree, false
 	}
-	return tree
+	return tree.rebalance(), inserted
 }
 
 // Delete deletes a key from the AVL tree.
-func (tree *AVLNode[T]) Delete(k T) *AVLNode[T] {
+func (tree *AVLNode[T, V]) Delete(k T) *AVLNode[T, V] {
+	tree, _ = tree.delete(k)
+	return tree
+}
+
+// delete deletes a key like Delete in one descent, and reports whether the key
+// was in the tree.
+func (tree *AVLNode[T, V]) delete(k T) (*AVLNode[T, V], bool) {
 	if tree == nil {
-		return nil
+		return nil, false
 	}
+	var deleted bool
 	if k < tree.key {
-		tree.left = tree.left.Delete(k)
+		tree.left, deleted = tree.left.delete(k)
 	} else if k > tree.key {
-		tree.right = tree.right.Delete(k)
+		tree.right, deleted = tree.right.delete(k)
 	} else {
 		if tree.left == nil {
-			return tree.right
+			return tree.right, true
 		} else if tree.right == nil {
-			return tree.left
+			return tree.left, true
 		}
-		// the deleted node has two children
+		// the deleted node has two children, take over the key, value and
+		// count of its successor
 		min := tree.right.min()
 		tree.key = min.key
-		tree.right = tree.right.Delete(min.key)
+		tree.value = min.value
+		tree.count = min.count
+		tree.right, _ = tree.right.delete(min.key)
+		deleted = true
 	}
-	// rebalance the tree
-	tree.level = max(tree.left.height(), tree.right.height()) + 1
+	return tree.rebalance(), deleted
+}
+
+// rebalance updates the level and size of the node whose subtrees are
+// balanced, and rotates it when the heights of its subtrees differ by more
+// than one. It returns the new root of the subtree.
+func (tree *AVLNode[T, V]) rebalance() *AVLNode[T, V] {
+	tree.update()
 	balance := tree.left.height() - tree.right.height()
 	if balance > 1 {
+		// left-left case
 		if tree.left.left.height() >= tree.left.right.height() {
 			return tree.rightRotate()
 		} else {
+			// left-right case
 			tree.left = tree.left.leftRotate()
 			return tree.rightRotate()
 		}
 	} else if balance < -1 {
+		// right-right case
 		if tree.right.right.height() >= tree.right.left.height() {
 			return tree.leftRotate()
 		} else {
+			// right-left case
 			tree.right = tree.right.rightRotate()
 			return tree.leftRotate()
 		}
@@ -106,7 +150,7 @@ func (tree *AVLNode[T]) Delete(k T) *AVLNode[T] {
 }
 
 // Search searches key in the AVL tree.
-func (tree *AVLNode[T]) Search(k T) *AVLNode[T] {
+func (tree *AVLNode[T, V]) Search(k T) *AVLNode[T, V] {
 	if tree == nil {
 		return nil
 	}
@@ -118,8 +162,60 @@ func (tree *AVLNode[T]) Search(k T) *AVLNode[T] {
 	return tree
 }
 
+// Rank returns the number of keys less than k in the AVL tree, each
+// occurrence of a key in a multiset is counted.
+func (tree *AVLNode[T, V]) Rank(k T) int {
+	rank := 0
+	for p := tree; p != nil; {
+		if k <= p.key {
+			p = p.left
+		} else {
+			rank += p.left.len() + p.count
+			p = p.right
+		}
+	}
+	return rank
+}
+
+// Select returns the i-th smallest key in the AVL tree counting from 0, each
+// occurrence of a key in a multiset takes one position. The second result is
+// false if i is out of range.
+func (tree *AVLNode[T, V]) Select(i int) (T, bool) {
+	if i < 0 || i >= tree.len() {
+		var zero T
+		return zero, false
+	}
+	p := tree
+	for {
+		l := p.left.len()
+		if i < l {
+			p = p.left
+		} else if i < l+p.count {
+			return p.key, true
+		} else {
+			i -= l + p.count
+			p = p.right
+		}
+	}
+}
+
+// CountRange returns the number of keys in [lo, hi) in the AVL tree.
+func (tree *AVLNode[T, V]) CountRange(lo, hi T) int {
+	if hi <= lo {
+		return 0
+	}
+	return tree.Rank(hi) - tree.Rank(lo)
+}
+
+// Median returns the median key of the AVL tree, which is the lower one of
+// the two middle keys when the number of keys is even. The second result is
+// false if the tree is empty.
+func (tree *AVLNode[T, V]) Median() (T, bool) {
+	return tree.Select((tree.len() - 1) / 2)
+}
+
 // min returns the minimum node in the AVL tree.
-func (tree *AVLNode[T]) min() *AVLNode[T] {
+func (tree *AVLNode[T, V]) min() *AVLNode[T, V] {
 	if tree.left == nil {
 		return tree
 	}
@@ -127,22 +223,22 @@ func (tree *AVLNode[T]) min() *AVLNode[T] {
 }
 
 // leftRotate performs a left rotation.
-func (tree *AVLNode[T]) leftRotate() *AVLNode[T] {
+func (tree *AVLNode[T, V]) leftRotate() *AVLNode[T, V] {
 	x := tree.right
 	tree.right = x.left
 	x.left = tree
-	tree.level = max(tree.left.height(), tree.right.height()) + 1
-	x.level = max(x.left.height(), x.right.height()) + 1
+	tree.update()
+	x.update()
 	return x
 }
 
 // rightRotate performs a right rotation.
-func (tree *AVLNode[T]) rightRotate() *AVLNode[T] {
+func (tree *AVLNode[T, V]) rightRotate() *AVLNode[T, V] {
 	x := tree.left
 	tree.left = x.right
 	x.right = tree
-	tree.level = max(tree.left.height(), tree.right.height()) + 1
-	x.level = max(x.left.height(), x.right.height()) + 1
+	tree.update()
+	x.update()
 	return x
 }
 
@@ -155,7 +251,7 @@ func max(a, b int) int {
 }
 
 // traverse traverses the AVL tree in-order.
-func (tree *AVLNode[T]) traverse() {
+func (tree *AVLNode[T, V]) traverse() {
 	if tree == nil {
 		return
 	}
@@ -163,3 +259,270 @@ func (tree *AVLNode[T]) traverse() {
 	fmt.Printf("%v at level %v", tree.key, tree.height())
 	tree.right.traverse()
 }
+
+// AVLTree is an ordered map backed by an AVL tree, it owns the root node so
+// callers never handle the roots returned by Insert and Delete. The zero value
+// is an empty map ready to use.
+type AVLTree[K constraints.Ordered, V any] struct {
+	root *AVLNode[K, V]
+	size int
+}
+
+// NewAVLTree returns a new empty AVL tree map.
+func NewAVLTree[K constraints.Ordered, V any]() *AVLTree[K, V] {
+	return &AVLTree[K, V]{}
+}
+
+// Len returns the number of keys in the map.
+func (m *AVLTree[K, V]) Len() int {
+	return m.size
+}
+
+// Put inserts the key with the value into the map, if the key is already in
+// the map, its value is replaced.
+func (m *AVLTree[K, V]) Put(k K, v V) {
+	var inserted bool
+	m.root, inserted = m.root.put(k, v, true)
+	if inserted {
+		m.size++
+	}
+}
+
+// Search returns the value of the key, the second result is false if the key
+// is not in the map.
+func (m *AVLTree[K, V]) Search(k K) (V, bool) {
+	node := m.root.Search(k)
+	if node == nil {
+		var zero V
+		return zero, false
+	}
+	return node.value, true
+}
+
+// Get is the same as Search, it's named after the map-style API.
+func (m *AVLTree[K, V]) Get(k K) (V, bool) {
+	return m.Search(k)
+}
+
+// Delete deletes the key from the map and reports whether it was present.
+func (m *AVLTree[K, V]) Delete(k K) bool {
+	var deleted bool
+	m.root, deleted = m.root.delete(k)
+	if deleted {
+		m.size--
+	}
+	return deleted
+}
+
+// AVLMultiset is an ordered multiset backed by an AVL tree, each distinct key
+// is stored in one node with the number of its occurrences. Rank, Select and
+// iteration see every occurrence. The zero value is an empty multiset ready to
+// use.
+type AVLMultiset[T constraints.Ordered] struct {
+	root *AVLNode[T, struct{}]
+}
+
+// NewAVLMultiset returns a new empty multiset.
+func NewAVLMultiset[T constraints.Ordered]() *AVLMultiset[T] {
+	return &AVLMultiset[T]{}
+}
+
+// Len returns the number of occurrences of all keys in the multiset.
+func (s *AVLMultiset[T]) Len() int {
+	return s.root.len()
+}
+
+// Add adds one occurrence of the key into the multiset.
+func (s *AVLMultiset[T]) Add(k T) {
+	s.root = s.root.add(k)
+}
+
+// Count returns the number of occurrences of the key in the multiset.
+func (s *AVLMultiset[T]) Count(k T) int {
+	node := s.root.Search(k)
+	if node == nil {
+		return 0
+	}
+	return node.count
+}
+
+// DeleteOne deletes one occurrence of the key and reports whether the key was
+// present.
+func (s *AVLMultiset[T]) DeleteOne(k T) bool {
+	if s.root.Search(k) == nil {
+		return false
+	}
+	s.root = s.root.deleteOne(k)
+	return true
+}
+
+// DeleteAll deletes all occurrences of the key and returns how many there were.
+func (s *AVLMultiset[T]) DeleteAll(k T) int {
+	n := s.Count(k)
+	if n > 0 {
+		s.root = s.root.Delete(k)
+	}
+	return n
+}
+
+// Rank returns the number of occurrences of keys less than k.
+func (s *AVLMultiset[T]) Rank(k T) int {
+	return s.root.Rank(k)
+}
+
+// Select returns the i-th smallest occurrence counting from 0, the second
+// result is false if i is out of range.
+func (s *AVLMultiset[T]) Select(i int) (T, bool) {
+	return s.root.Select(i)
+}
+
+// Ascend calls f for every occurrence of keys in ascending order, the
+// iteration stops when f returns false.
+func (s *AVLMultiset[T]) Ascend(f func(k T) bool) {
+	s.root.Ascend(f)
+}
+
+// add adds one occurrence of the key into the tree and returns the new root.
+func (tree *AVLNode[T, V]) add(k T) *AVLNode[T, V] {
+	if tree == nil {
+		return newAVLNode[T, V](k)
+	}
+	if k < tree.key {
+		tree.left = tree.left.add(k)
+	} else if k > tree.key {
+		tree.right = tree.right.add(k)
+	} else {
+		tree.count++
+		tree.size++
+		return tree
+	}
+	return tree.rebalance()
+}
+
+// deleteOne deletes one occurrence of the key from the tree, the node is
+// deleted when it is the last occurrence. It returns the new root.
+func (tree *AVLNode[T, V]) deleteOne(k T) *AVLNode[T, V] {
+	if tree == nil {
+		return nil
+	}
+	if k < tree.key {
+		tree.left = tree.left.deleteOne(k)
+	} else if k > tree.key {
+		tree.right = tree.right.deleteOne(k)
+	} else if tree.count > 1 {
+		tree.count--
+		tree.size--
+		return tree
+	} else {
+		return tree.Delete(k)
+	}
+	return tree.rebalance()
+}
+
+// AVLIterator walks the keys of an AVL tree in order with an explicit stack
+// instead of recursion, the stack holds the nodes whose keys are not visited
+// yet along the current path. A key occurring more than once in a multiset is
+// returned once for each occurrence. The tree must not be modified during
+// iteration.
+type AVLIterator[T constraints.Ordered, V any] struct {
+	stack   linear.Stack[*AVLNode[T, V]]
+	reverse bool
+	last    *AVLNode[T, V] // the node returned by Next at last
+	repeat  int            // remaining occurrences of the last node
+}
+
+// Iterator returns an iterator which walks the keys in ascending order.
+func (tree *AVLNode[T, V]) Iterator() *AVLIterator[T, V] {
+	it := &AVLIterator[T, V]{}
+	it.pushPath(tree)
+	return it
+}
+
+// ReverseIterator returns an iterator which walks the keys in descending order.
+func (tree *AVLNode[T, V]) ReverseIterator() *AVLIterator[T, V] {
+	it := &AVLIterator[T, V]{reverse: true}
+	it.pushPath(tree)
+	return it
+}
+
+// seekIterator returns an iterator which walks the keys not less than lo in
+// ascending order.
+func (tree *AVLNode[T, V]) seekIterator(lo T) *AVLIterator[T, V] {
+	it := &AVLIterator[T, V]{}
+	for p := tree; p != nil; {
+		if p.key < lo {
+			p = p.right
+		} else {
+			it.stack.Push(p)
+			p = p.left
+		}
+	}
+	return it
+}
+
+// Next returns the next key, the second result is false when all keys have
+// been visited.
+func (it *AVLIterator[T, V]) Next() (T, bool) {
+	if it.repeat > 0 {
+		it.repeat--
+		return it.last.key, true
+	}
+	node := it.next()
+	if node == nil {
+		var zero T
+		return zero, false
+	}
+	it.last, it.repeat = node, node.count-1
+	return node.key, true
+}
+
+// next returns the next node, or nil when all nodes have been visited.
+func (it *AVLIterator[T, V]) next() *AVLNode[T, V] {
+	node, ok := it.stack.Pop()
+	if !ok {
+		return nil
+	}
+	if it.reverse {
+		it.pushPath(node.left)
+	} else {
+		it.pushPath(node.right)
+	}
+	return node
+}
+
+// pushPath pushes the node and its left spine, or its right spine when the
+// iterator is reversed.
+func (it *AVLIterator[T, V]) pushPath(node *AVLNode[T, V]) {
+	for node != nil {
+		it.stack.Push(node)
+		if it.reverse {
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+}
+
+// Ascend calls f for every key in ascending order, the iteration stops when f
+// returns false.
+func (tree *AVLNode[T, V]) Ascend(f func(k T) bool) {
+	it := tree.Iterator()
+	for k, ok := it.Next(); ok && f(k); k, ok = it.Next() {
+	}
+}
+
+// Descend calls f for every key in descending order, the iteration stops when
+// f returns false.
+func (tree *AVLNode[T, V]) Descend(f func(k T) bool) {
+	it := tree.ReverseIterator()
+	for k, ok := it.Next(); ok && f(k); k, ok = it.Next() {
+	}
+}
+
+// AscendRange calls f for every key in [lo, hi) in ascending order, the
+// iteration stops when f returns false.
+func (tree *AVLNode[T, V]) AscendRange(lo, hi T, f func(k T) bool) {
+	it := tree.seekIterator(lo)
+	for k, ok := it.Next(); ok && k < hi && f(k); k, ok = it.Next() {
+	}
+}
@@ -0,0 +1,164 @@
+package tree
+
+import (
+	"sync"
+
+	"golang.org/x/exp/constraints"
+)
+
+// parallelThreshold is the total size of two trees from which the set
+// operations handle the left and right halves in parallel goroutines, smaller
+// inputs are not worth the cost of starting goroutines.
+const parallelThreshold = 1 << 12
+
+// Join joins the tree, the key k and the right tree into one AVL tree, all
+// keys in the tree must be less than k, and all keys in the right tree must be
+// greater than k, the key k has the zero value. It takes O(|h1 - h2| + 1) time
+// where h1 and h2 are the heights of two trees. Both trees are consumed, only
+// the returned tree should be used after joining.
+func (tree *AVLNode[T, V]) Join(k T, right *AVLNode[T, V]) *AVLNode[T, V] {
+	return join(tree, newAVLNode[T, V](k), right)
+}
+
+// Split splits the AVL tree into the tree of keys less than k and the tree of
+// keys greater than k, the second result reports whether k is in the tree. It
+// takes O(log n) time. The tree is consumed, only the returned trees should be
+// used after splitting.
+func (tree *AVLNode[T, V]) Split(k T) (*AVLNode[T, V], bool, *AVLNode[T, V]) {
+	left, mid, right := split(tree, k)
+	return left, mid != nil, right
+}
+
+// Union returns the tree of keys in the tree or the other tree, the value of
+// a key in both trees is taken from the tree. Intersection and Difference work
+// in the same way, they take O(m log(n/m + 1)) time where m is the size of the
+// smaller tree and n of the larger one, and large inputs are processed by
+// parallel goroutines. Both trees are consumed, their nodes are reused by the
+// returned tree.
+func (tree *AVLNode[T, V]) Union(other *AVLNode[T, V]) *AVLNode[T, V] {
+	if tree == nil {
+		return other
+	}
+	if other == nil {
+		return tree
+	}
+	l2, _, r2 := split(other, tree.key)
+	l1, r1 := tree.left, tree.right
+	var left, right *AVLNode[T, V]
+	parallel(tree.len()+other.len() >= parallelThreshold,
+		func() { left = l1.Union(l2) },
+		func() { right = r1.Union(r2) })
+	return join(left, tree, right)
+}
+
+// Intersection returns the tree of keys in both the tree and the other tree,
+// the values are taken from the tree.
+func (tree *AVLNode[T, V]) Intersection(other *AVLNode[T, V]) *AVLNode[T, V] {
+	if tree == nil || other == nil {
+		return nil
+	}
+	l2, mid, r2 := split(other, tree.key)
+	l1, r1 := tree.left, tree.right
+	var left, right *AVLNode[T, V]
+	parallel(tree.len()+other.len() >= parallelThreshold,
+		func() { left = l1.Intersection(l2) },
+		func() { right = r1.Intersection(r2) })
+	if mid == nil {
+		return join2(left, right)
+	}
+	return join(left, tree, right)
+}
+
+// Difference returns the tree of keys in the tree but not in the other tree.
+func (tree *AVLNode[T, V]) Difference(other *AVLNode[T, V]) *AVLNode[T, V] {
+	if tree == nil {
+		return nil
+	}
+	if other == nil {
+		return tree
+	}
+	l1, _, r1 := split(tree, other.key)
+	l2, r2 := other.left, other.right
+	var left, right *AVLNode[T, V]
+	parallel(tree.len()+other.len() >= parallelThreshold,
+		func() { left = l1.Difference(l2) },
+		func() { right = r1.Difference(r2) })
+	return join2(left, right)
+}
+
+// join joins the left tree, the single node mid and the right tree, it walks
+// down the spine of the taller tree until the heights are close, attaches the
+// other tree there and rebalances the nodes on the way back.
+func join[T constraints.Ordered, V any](left, mid, right *AVLNode[T, V]) *AVLNode[T, V] {
+	if left.height() > right.height()+1 {
+		left.right = join(left.right, mid, right)
+		return left.rebalance()
+	}
+	if right.height() > left.height()+1 {
+		right.left = join(left, mid, right.left)
+		return right.rebalance()
+	}
+	mid.left, mid.right = left, right
+	mid.update()
+	return mid
+}
+
+// join2 joins the left and right trees without a middle key by taking the
+// maximum node of the left tree as the middle one.
+func join2[T constraints.Ordered, V any](left, right *AVLNode[T, V]) *AVLNode[T, V] {
+	if left == nil {
+		return right
+	}
+	rest, last := splitLast(left)
+	return join(rest, last, right)
+}
+
+// splitLast detaches the maximum node from the tree, and returns the rest of
+// the tree and the maximum node.
+func splitLast[T constraints.Ordered, V any](tree *AVLNode[T, V]) (*AVLNode[T, V], *AVLNode[T, V]) {
+	if tree.right == nil {
+		rest := tree.left
+		tree.left = nil
+		tree.update()
+		return rest, tree
+	}
+	rest, last := splitLast(tree.right)
+	return join(tree.left, tree, rest), last
+}
+
+// split splits the tree by k into the tree of smaller keys, the detached node
+// holding k or nil, and the tree of greater keys.
+func split[T constraints.Ordered, V any](tree *AVLNode[T, V], k T) (*AVLNode[T, V], *AVLNode[T, V], *AVLNode[T, V]) {
+	if tree == nil {
+		return nil, nil, nil
+	}
+	left, right := tree.left, tree.right
+	if k < tree.key {
+		l, mid, r := split(left, k)
+		return l, mid, join(r, tree, right)
+	}
+	if k > tree.key {
+		l, mid, r := split(right, k)
+		return join(left, tree, l), mid, r
+	}
+	tree.left, tree.right = nil, nil
+	tree.update()
+	return left, tree, right
+}
+
+// parallel runs f and g, in two goroutines if concurrent is true.
+func parallel(concurrent bool, f, g func()) {
+	if !concurrent {
+		f()
+		g()
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f()
+	}()
+	g()
+	wg.Wait()
+}
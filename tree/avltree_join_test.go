@@ -0,0 +1,188 @@
+package tree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// avlKeys returns the keys of the tree in order.
+func avlKeys(tree *AVLNode[int, struct{}]) []int {
+	var keys []int
+	tree.Ascend(func(k int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// randomSet returns n random keys in [0, limit).
+func randomSet(r *rand.Rand, n, limit int) map[int]bool {
+	set := make(map[int]bool)
+	for i := 0; i < n; i++ {
+		set[r.Intn(limit)] = true
+	}
+	return set
+}
+
+// avlFromSet builds an AVL tree with the keys of the set.
+func avlFromSet(set map[int]bool) *AVLNode[int, struct{}] {
+	var tree *AVLNode[int, struct{}]
+	for k := range set {
+		tree = tree.Insert(k)
+	}
+	return tree
+}
+
+// sortedKeys returns the keys in [0, limit) for which keep returns true.
+func sortedKeys(limit int, keep func(k int) bool) []int {
+	var keys []int
+	for k := 0; k < limit; k++ {
+		if keep(k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func TestJoinAvlTrees(t *testing.T) {
+	// GIVEN
+	left := newIntAvlTree(1, 2, 3)
+	var right *AVLNode[int, struct{}]
+	for k := 10; k < 40; k++ {
+		right = right.Insert(k)
+	}
+
+	// WHEN
+	tree := left.Join(5, right)
+
+	// THEN
+	if err := checkAvlTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree.len() != 34 {
+		t.Errorf("len() = %d, want 34", tree.len())
+	}
+	if keys := avlKeys(tree); keys[3] != 5 || keys[4] != 10 {
+		t.Errorf("keys = %v", keys)
+	}
+}
+
+func TestSplitAvlTree(t *testing.T) {
+	// GIVEN
+	var tree *AVLNode[int, struct{}]
+	for k := 0; k < 100; k += 2 {
+		tree = tree.Insert(k)
+	}
+
+	// WHEN
+	left, found, right := tree.Split(40)
+
+	// THEN
+	if !found {
+		t.Error("Split(40) should find 40")
+	}
+	if err := checkAvlTree(left); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAvlTree(right); err != nil {
+		t.Fatal(err)
+	}
+	if want := sortedKeys(40, func(k int) bool { return k%2 == 0 }); !equalInts(avlKeys(left), want) {
+		t.Errorf("left keys = %v, want %v", avlKeys(left), want)
+	}
+	if right.len() != 29 || right.min().key != 42 {
+		t.Errorf("right has %d keys from %d, want 29 from 42", right.len(), right.min().key)
+	}
+	_, found, _ = right.Split(43)
+	if found {
+		t.Error("Split(43) should not find 43")
+	}
+}
+
+func TestAvlSetOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(37))
+	for round := 0; round < 30; round++ {
+		// GIVEN
+		const limit = 400
+		s1 := randomSet(r, r.Intn(300), limit)
+		s2 := randomSet(r, r.Intn(300), limit)
+
+		// WHEN
+		union := avlFromSet(s1).Union(avlFromSet(s2))
+		inter := avlFromSet(s1).Intersection(avlFromSet(s2))
+		diff := avlFromSet(s1).Difference(avlFromSet(s2))
+
+		// THEN
+		for name, got := range map[string]*AVLNode[int, struct{}]{"union": union, "intersection": inter, "difference": diff} {
+			if err := checkAvlTree(got); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if want := sortedKeys(limit, func(k int) bool { return s1[k] || s2[k] }); !equalInts(avlKeys(union), want) {
+			t.Fatalf("union = %v, want %v", avlKeys(union), want)
+		}
+		if want := sortedKeys(limit, func(k int) bool { return s1[k] && s2[k] }); !equalInts(avlKeys(inter), want) {
+			t.Fatalf("intersection = %v, want %v", avlKeys(inter), want)
+		}
+		if want := sortedKeys(limit, func(k int) bool { return s1[k] && !s2[k] }); !equalInts(avlKeys(diff), want) {
+			t.Fatalf("difference = %v, want %v", avlKeys(diff), want)
+		}
+	}
+}
+
+func TestAvlUnionKeepsValuesOfTree(t *testing.T) {
+	// GIVEN
+	a := NewAVLTree[int, string]()
+	b := NewAVLTree[int, string]()
+	a.Put(1, "a1")
+	a.Put(2, "a2")
+	b.Put(2, "b2")
+	b.Put(3, "b3")
+
+	// WHEN
+	m := AVLTree[int, string]{root: a.root.Union(b.root)}
+
+	// THEN
+	if v, _ := m.Get(2); v != "a2" {
+		t.Errorf("Get(2) = %q, want \"a2\"", v)
+	}
+	if v, _ := m.Get(3); v != "b3" {
+		t.Errorf("Get(3) = %q, want \"b3\"", v)
+	}
+}
+
+func TestLargeAvlSetOperationsInParallel(t *testing.T) {
+	// GIVEN
+	const n = 3 * parallelThreshold
+	evens := make(map[int]bool)
+	thirds := make(map[int]bool)
+	for k := 0; k < n; k++ {
+		if k%2 == 0 {
+			evens[k] = true
+		}
+		if k%3 == 0 {
+			thirds[k] = true
+		}
+	}
+
+	// WHEN
+	union := avlFromSet(evens).Union(avlFromSet(thirds))
+	inter := avlFromSet(evens).Intersection(avlFromSet(thirds))
+	diff := avlFromSet(evens).Difference(avlFromSet(thirds))
+
+	// THEN
+	for name, got := range map[string]*AVLNode[int, struct{}]{"union": union, "intersection": inter, "difference": diff} {
+		if err := checkAvlTree(got); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if want := len(sortedKeys(n, func(k int) bool { return k%2 == 0 || k%3 == 0 })); union.len() != want {
+		t.Errorf("union has %d keys, want %d", union.len(), want)
+	}
+	if want := len(sortedKeys(n, func(k int) bool { return k%6 == 0 })); inter.len() != want {
+		t.Errorf("intersection has %d keys, want %d", inter.len(), want)
+	}
+	if want := len(sortedKeys(n, func(k int) bool { return k%2 == 0 && k%3 != 0 })); diff.len() != want {
+		t.Errorf("difference has %d keys, want %d", diff.len(), want)
+	}
+}
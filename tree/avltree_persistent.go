@@ -0,0 +1,140 @@
+package tree
+
+import "golang.org/x/exp/constraints"
+
+// PersistentAVL is an immutable ordered map backed by an AVL tree. Insert and
+// Delete never modify the existing nodes, they copy the nodes on the path from
+// the root to the changed key and return a new version which shares all other
+// subtrees with the old one. So every version stays valid, takes O(log n)
+// extra space and is safe to read from multiple goroutines. The zero value is
+// an empty map ready to use.
+type PersistentAVL[K constraints.Ordered, V any] struct {
+	root *AVLNode[K, V]
+}
+
+// Len returns the number of keys in this version.
+func (m PersistentAVL[K, V]) Len() int {
+	return m.root.len()
+}
+
+// Get returns the value of the key in this version, the second result is
+// false if the key is not in it.
+func (m PersistentAVL[K, V]) Get(k K) (V, bool) {
+	node := m.root.Search(k)
+	if node == nil {
+		var zero V
+		return zero, false
+	}
+	return node.value, true
+}
+
+// Insert returns a new version with the key set to the value, if the key is
+// already in the map, its value is replaced in the new version.
+func (m PersistentAVL[K, V]) Insert(k K, v V) PersistentAVL[K, V] {
+	return PersistentAVL[K, V]{root: m.root.insertCopy(k, v)}
+}
+
+// Delete returns a new version without the key, if the key is not in the map,
+// this version is returned as is.
+func (m PersistentAVL[K, V]) Delete(k K) PersistentAVL[K, V] {
+	root, _ := m.root.deleteCopy(k)
+	return PersistentAVL[K, V]{root: root}
+}
+
+// Ascend calls f for every key with its value in ascending order, the
+// iteration stops when f returns false.
+func (m PersistentAVL[K, V]) Ascend(f func(k K, v V) bool) {
+	it := m.root.Iterator()
+	for node := it.next(); node != nil; node = it.next() {
+		if !f(node.key, node.value) {
+			return
+		}
+	}
+}
+
+// clone returns a shallow copy of the node, the copy shares the children.
+func (tree *AVLNode[T, V]) clone() *AVLNode[T, V] {
+	c := *tree
+	return &c
+}
+
+// insertCopy inserts the key with its value by copying the path, and returns
+// the new root, the nodes of the tree are never modified.
+func (tree *AVLNode[T, V]) insertCopy(k T, v V) *AVLNode[T, V] {
+	if tree == nil {
+		node := newAVLNode[T, V](k)
+		node.value = v
+		return node
+	}
+	c := tree.clone()
+	if k < tree.key {
+		c.left = tree.left.insertCopy(k, v)
+	} else if k > tree.key {
+		c.right = tree.right.insertCopy(k, v)
+	} else {
+		c.value = v
+		return c
+	}
+	return c.rebalanceCopy()
+}
+
+// deleteCopy deletes the key by copying the path, and returns the new root and
+// whether the key is found. If the key is not found, the tree itself is
+// returned without copying.
+func (tree *AVLNode[T, V]) deleteCopy(k T) (*AVLNode[T, V], bool) {
+	if tree == nil {
+		return nil, false
+	}
+	var c *AVLNode[T, V]
+	if k < tree.key {
+		left, ok := tree.left.deleteCopy(k)
+		if !ok {
+			return tree, false
+		}
+		c = tree.clone()
+		c.left = left
+	} else if k > tree.key {
+		right, ok := tree.right.deleteCopy(k)
+		if !ok {
+			return tree, false
+		}
+		c = tree.clone()
+		c.right = right
+	} else {
+		if tree.left == nil {
+			return tree.right, true
+		} else if tree.right == nil {
+			return tree.left, true
+		}
+		// the deleted node has two children, the copy takes over the key,
+		// value and count of its successor
+		min := tree.right.min()
+		c = tree.clone()
+		c.key, c.value, c.count = min.key, min.value, min.count
+		c.right, _ = tree.right.deleteCopy(min.key)
+	}
+	return c.rebalanceCopy(), true
+}
+
+// rebalanceCopy is the same as rebalance for a copied node, but it copies the
+// children before rotating them, since they may be shared with other versions.
+func (tree *AVLNode[T, V]) rebalanceCopy() *AVLNode[T, V] {
+	tree.update()
+	balance := tree.left.height() - tree.right.height()
+	if balance > 1 {
+		tree.left = tree.left.clone()
+		if tree.left.left.height() < tree.left.right.height() {
+			tree.left.right = tree.left.right.clone()
+			tree.left = tree.left.leftRotate()
+		}
+		return tree.rightRotate()
+	} else if balance < -1 {
+		tree.right = tree.right.clone()
+		if tree.right.right.height() < tree.right.left.height() {
+			tree.right.left = tree.right.left.clone()
+			tree.right = tree.right.rightRotate()
+		}
+		return tree.leftRotate()
+	}
+	return tree
+}
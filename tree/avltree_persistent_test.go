@@ -0,0 +1,135 @@
+package tree
+
+import (
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// persistentPairs returns the keys and values of the version in order.
+func persistentPairs(m PersistentAVL[int, int]) [][2]int {
+	var pairs [][2]int
+	m.Ascend(func(k, v int) bool {
+		pairs = append(pairs, [2]int{k, v})
+		return true
+	})
+	return pairs
+}
+
+func TestPersistentAvlKeepsOldVersions(t *testing.T) {
+	// GIVEN
+	var v0 PersistentAVL[string, int]
+	v1 := v0.Insert("a", 1)
+	v2 := v1.Insert("b", 2)
+
+	// WHEN
+	v3 := v2.Insert("a", 10)
+	v4 := v3.Delete("b")
+
+	// THEN
+	if v0.Len() != 0 || v1.Len() != 1 || v2.Len() != 2 || v3.Len() != 2 || v4.Len() != 1 {
+		t.Errorf("Len() = %d, %d, %d, %d, %d, want 0, 1, 2, 2, 1",
+			v0.Len(), v1.Len(), v2.Len(), v3.Len(), v4.Len())
+	}
+	if v, _ := v2.Get("a"); v != 1 {
+		t.Errorf("v2.Get(a) = %d, want 1", v)
+	}
+	if v, _ := v3.Get("a"); v != 10 {
+		t.Errorf("v3.Get(a) = %d, want 10", v)
+	}
+	if _, ok := v4.Get("b"); ok {
+		t.Error("v4.Get(b) should return false")
+	}
+	if v, ok := v3.Get("b"); !ok || v != 2 {
+		t.Errorf("v3.Get(b) = %d, %v, want 2, true", v, ok)
+	}
+}
+
+func TestPersistentAvlWithInterfaceValues(t *testing.T) {
+	// GIVEN
+	var v0 PersistentAVL[int, error]
+	v1 := v0.Insert(1, io.EOF)
+
+	// WHEN
+	v2 := v1.Insert(1, nil)
+
+	// THEN
+	if v, ok := v1.Get(1); !ok || v != io.EOF {
+		t.Errorf("v1.Get(1) = %v, %v, want EOF, true", v, ok)
+	}
+	if v, ok := v2.Get(1); !ok || v != nil {
+		t.Errorf("v2.Get(1) = %v, %v, want nil, true", v, ok)
+	}
+	v2.Ascend(func(k int, v error) bool {
+		if k != 1 || v != nil {
+			t.Errorf("Ascend() visits %d, %v, want 1, nil", k, v)
+		}
+		return true
+	})
+}
+
+func TestPersistentAvlSharesUnchangedSubtrees(t *testing.T) {
+	// GIVEN
+	var v1 PersistentAVL[int, int]
+	for k := 0; k < 15; k++ {
+		v1 = v1.Insert(k, k)
+	}
+
+	// WHEN
+	v2 := v1.Insert(14, 140)
+	v3 := v1.Delete(100)
+
+	// THEN
+	if v1.root == v2.root {
+		t.Error("root should be copied")
+	}
+	if v1.root.left != v2.root.left {
+		t.Error("left subtree should be shared")
+	}
+	if v3.root != v1.root {
+		t.Error("deleting a missing key should return the same version")
+	}
+}
+
+func TestPersistentAvlRandomVersions(t *testing.T) {
+	// GIVEN
+	r := rand.New(rand.NewSource(38))
+	versions := []PersistentAVL[int, int]{{}}
+	models := []map[int]int{{}}
+
+	// WHEN
+	for i := 0; i < 1000; i++ {
+		base := r.Intn(len(versions))
+		m := versions[base]
+		model := make(map[int]int)
+		for k, v := range models[base] {
+			model[k] = v
+		}
+		k := r.Intn(100)
+		if r.Intn(3) == 0 {
+			m = m.Delete(k)
+			delete(model, k)
+		} else {
+			m = m.Insert(k, i)
+			model[k] = i
+		}
+		versions = append(versions, m)
+		models = append(models, model)
+	}
+
+	// THEN
+	for i, m := range versions {
+		if err := checkAvlTree(m.root); err != nil {
+			t.Fatalf("version %d: %v", i, err)
+		}
+		pairs := persistentPairs(m)
+		if len(pairs) != len(models[i]) {
+			t.Fatalf("version %d has %d keys, want %d", i, len(pairs), len(models[i]))
+		}
+		for _, p := range pairs {
+			if v, ok := models[i][p[0]]; !ok || v != p[1] {
+				t.Fatalf("version %d has %d = %d, want %d", i, p[0], p[1], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package tree
+
+import "golang.org/x/exp/constraints"
+
+// AVLFromSorted builds a perfectly balanced AVL tree from keys sorted in
+// ascending order in O(n) time without any rotation, a run of equal keys
+// becomes one node counting its occurrences like AVLMultiset. It panics if the
+// keys are not sorted.
+func AVLFromSorted[T constraints.Ordered](keys []T) *AVLNode[T, struct{}] {
+	distinct := make([]T, 0, len(keys))
+	counts := make([]int, 0, len(keys))
+	for i, k := range keys {
+		if i > 0 && k < keys[i-1] {
+			panic("tree: keys of AVLFromSorted are not sorted")
+		}
+		if i > 0 && k == keys[i-1] {
+			counts[len(counts)-1]++
+			continue
+		}
+		distinct = append(distinct, k)
+		counts = append(counts, 1)
+	}
+	return buildAVL(distinct, counts)
+}
+
+// buildAVL builds the tree by taking the middle key as the root and the two
+// halves as its subtrees, so the heights of any two subtrees differ by at most
+// one.
+func buildAVL[T constraints.Ordered](keys []T, counts []int) *AVLNode[T, struct{}] {
+	if len(keys) == 0 {
+		return nil
+	}
+	mid := len(keys) / 2
+	node := NewAVLNode(keys[mid])
+	node.count = counts[mid]
+	node.left = buildAVL(keys[:mid], counts[:mid])
+	node.right = buildAVL(keys[mid+1:], counts[mid+1:])
+	node.update()
+	return node
+}
+
+// ToSortedSlice returns all keys of the AVL tree in ascending order, a key
+// occurring more than once in a multiset is repeated. Passing the result to
+// AVLFromSorted restores an equal tree.
+func (tree *AVLNode[T, V]) ToSortedSlice() []T {
+	keys := make([]T, 0, tree.len())
+	tree.Ascend(func(k T) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
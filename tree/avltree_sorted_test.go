@@ -0,0 +1,85 @@
+package tree
+
+import "testing"
+
+func TestAvlFromSorted(t *testing.T) {
+	for n := 0; n < 200; n++ {
+		// GIVEN
+		keys := make([]int, n)
+		for i := range keys {
+			keys[i] = i * 3
+		}
+
+		// WHEN
+		tree := AVLFromSorted(keys)
+
+		// THEN
+		if err := checkAvlTree(tree); err != nil {
+			t.Fatalf("tree of %d keys: %v", n, err)
+		}
+		// a perfectly balanced tree of n keys has the height of bits.Len(n)
+		height := 0
+		for m := n; m > 0; m >>= 1 {
+			height++
+		}
+		if tree.height() != height {
+			t.Fatalf("tree of %d keys has height %d, want %d", n, tree.height(), height)
+		}
+		if !equalInts(tree.ToSortedSlice(), keys) {
+			t.Fatalf("ToSortedSlice() = %v, want %v", tree.ToSortedSlice(), keys)
+		}
+	}
+}
+
+func TestAvlFromSortedWithDuplicates(t *testing.T) {
+	// GIVEN
+	keys := []int{1, 1, 2, 3, 3, 3, 4}
+
+	// WHEN
+	tree := AVLFromSorted(keys)
+
+	// THEN
+	if err := checkAvlTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree.len() != 7 {
+		t.Errorf("len() = %d, want 7", tree.len())
+	}
+	if node := tree.Search(3); node == nil || node.count != 3 {
+		t.Error("key 3 should occur 3 times")
+	}
+	if !equalInts(tree.ToSortedSlice(), keys) {
+		t.Errorf("ToSortedSlice() = %v, want %v", tree.ToSortedSlice(), keys)
+	}
+}
+
+func TestAvlFromSortedKeepsWorkingAfterUpdates(t *testing.T) {
+	// GIVEN
+	tree := AVLFromSorted([]string{"b", "d", "f", "h"})
+
+	// WHEN
+	tree = tree.Insert("a")
+	tree = tree.Insert("c")
+	tree = tree.Delete("h")
+
+	// THEN
+	if err := checkAvlTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	got := tree.ToSortedSlice()
+	if len(got) != 5 || got[0] != "a" || got[4] != "f" {
+		t.Errorf("ToSortedSlice() = %v, want [a b c d f]", got)
+	}
+}
+
+func TestAvlFromUnsortedKeys(t *testing.T) {
+	// THEN
+	defer func() {
+		if recover() == nil {
+			t.Error("AVLFromSorted() should panic")
+		}
+	}()
+
+	// WHEN
+	AVLFromSorted([]int{1, 3, 2})
+}
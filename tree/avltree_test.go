@@ -1,6 +1,13 @@
 package tree
 
-import "testing"
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/exp/constraints"
+)
 
 // TestIntAvlTree tests the very simple AVL tree with int type.
 func TestIntAvlTree(t *testing.T) {
@@ -269,3 +276,409 @@ func TestStringAvlTree(t *testing.T) {
 		t.Errorf("tree.right.left.key == e && tree.right.right.key == g")
 	}
 }
+
+// newIntAvlTree builds an AVL tree with the given keys.
+func newIntAvlTree(keys ...int) *AVLNode[int, struct{}] {
+	var tree *AVLNode[int, struct{}]
+	for _, k := range keys {
+		tree = tree.Insert(k)
+	}
+	return tree
+}
+
+// equalInts reports whether two int slices are equal.
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAvlTreeIterators(t *testing.T) {
+	// GIVEN
+	tree := newIntAvlTree(50, 20, 80, 10, 30, 70, 90, 60)
+
+	// WHEN
+	var forward, reverse []int
+	it := tree.Iterator()
+	for k, ok := it.Next(); ok; k, ok = it.Next() {
+		forward = append(forward, k)
+	}
+	rit := tree.ReverseIterator()
+	for k, ok := rit.Next(); ok; k, ok = rit.Next() {
+		reverse = append(reverse, k)
+	}
+
+	// THEN
+	if want := []int{10, 20, 30, 50, 60, 70, 80, 90}; !equalInts(forward, want) {
+		t.Errorf("Iterator() visits %v, want %v", forward, want)
+	}
+	if want := []int{90, 80, 70, 60, 50, 30, 20, 10}; !equalInts(reverse, want) {
+		t.Errorf("ReverseIterator() visits %v, want %v", reverse, want)
+	}
+	var empty *AVLNode[int, struct{}]
+	if _, ok := empty.Iterator().Next(); ok {
+		t.Error("Next() of empty tree should return false")
+	}
+}
+
+func TestAvlTreeAscendAndDescendStopEarly(t *testing.T) {
+	// GIVEN
+	tree := newIntAvlTree(5, 3, 8, 1, 4, 7, 9)
+
+	// WHEN
+	var asc, desc []int
+	tree.Ascend(func(k int) bool {
+		asc = append(asc, k)
+		return k < 4
+	})
+	tree.Descend(func(k int) bool {
+		desc = append(desc, k)
+		return len(desc) < 2
+	})
+
+	// THEN
+	if want := []int{1, 3, 4}; !equalInts(asc, want) {
+		t.Errorf("Ascend() visits %v, want %v", asc, want)
+	}
+	if want := []int{9, 8}; !equalInts(desc, want) {
+		t.Errorf("Descend() visits %v, want %v", desc, want)
+	}
+}
+
+func TestAvlTreeAscendRange(t *testing.T) {
+	// GIVEN
+	var keys []int
+	for i := 0; i < 100; i += 2 {
+		keys = append(keys, i)
+	}
+	tree := newIntAvlTree(keys...)
+
+	// WHEN
+	var got []int
+	tree.AscendRange(31, 40, func(k int) bool {
+		got = append(got, k)
+		return true
+	})
+
+	// THEN
+	if want := []int{32, 34, 36, 38}; !equalInts(got, want) {
+		t.Errorf("AscendRange(31, 40) visits %v, want %v", got, want)
+	}
+	got = nil
+	tree.AscendRange(40, 40, func(k int) bool {
+		got = append(got, k)
+		return true
+	})
+	if len(got) != 0 {
+		t.Errorf("AscendRange(40, 40) visits %v, want none", got)
+	}
+}
+
+func TestAvlTreeMap(t *testing.T) {
+	// GIVEN
+	m := NewAVLTree[string, int]()
+	for i, k := range []string{"d", "b", "f", "a", "c", "e", "g"} {
+		m.Put(k, i)
+	}
+
+	// WHEN
+	m.Put("b", 100)
+	deleted := m.Delete("d")
+	notDeleted := m.Delete("z")
+
+	// THEN
+	if !deleted || notDeleted {
+		t.Errorf("Delete() = %v, %v, want true, false", deleted, notDeleted)
+	}
+	if m.Len() != 6 {
+		t.Errorf("Len() = %d, want 6", m.Len())
+	}
+	if v, ok := m.Search("b"); !ok || v != 100 {
+		t.Errorf("Search(b) = %d, %v, want 100, true", v, ok)
+	}
+	if _, ok := m.Get("d"); ok {
+		t.Error("Get(d) should return false")
+	}
+	// d had two children, so its successor e was moved into its node
+	if v, ok := m.Get("e"); !ok || v != 5 {
+		t.Errorf("Get(e) = %d, %v, want 5, true", v, ok)
+	}
+}
+
+func TestAvlTreeMapWithInterfaceValues(t *testing.T) {
+	// GIVEN
+	var m AVLTree[int, error]
+	m.Put(1, io.EOF)
+
+	// WHEN
+	m.Put(1, nil)
+
+	// THEN
+	if v, ok := m.Get(1); !ok || v != nil {
+		t.Errorf("Get(1) = %v, %v, want nil, true", v, ok)
+	}
+	if !m.Delete(1) || m.Delete(1) || m.Len() != 0 {
+		t.Errorf("Delete(1) twice should return true then false, Len() = %d, want 0", m.Len())
+	}
+}
+
+func TestAvlTreeMapRandomly(t *testing.T) {
+	// GIVEN
+	r := rand.New(rand.NewSource(35))
+	var m AVLTree[int, int]
+	model := make(map[int]int)
+
+	// WHEN
+	for i := 0; i < 5000; i++ {
+		k := r.Intn(300)
+		if r.Intn(3) == 0 {
+			_, exist := model[k]
+			if ok := m.Delete(k); ok != exist {
+				t.Fatalf("Delete(%d) = %v, want %v", k, ok, exist)
+			}
+			delete(model, k)
+		} else {
+			m.Put(k, i)
+			model[k] = i
+		}
+	}
+
+	// THEN
+	if m.Len() != len(model) {
+		t.Fatalf("Len() = %d, want %d", m.Len(), len(model))
+	}
+	for k, want := range model {
+		if v, ok := m.Get(k); !ok || v != want {
+			t.Fatalf("Get(%d) = %d, %v, want %d, true", k, v, ok, want)
+		}
+	}
+	if err := checkAvlTree(m.root); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkAvlTree checks the keys are in BST order, the levels are correct and
+// the heights of subtrees differ by at most one.
+func checkAvlTree[T constraints.Ordered, V any](tree *AVLNode[T, V]) error {
+	var prev *T
+	var check func(node *AVLNode[T, V]) (int, error)
+	check = func(node *AVLNode[T, V]) (int, error) {
+		if node == nil {
+			return 0, nil
+		}
+		lh, err := check(node.left)
+		if err != nil {
+			return 0, err
+		}
+		if node.count < 1 {
+			return 0, fmt.Errorf("key %v has count %d", node.key, node.count)
+		}
+		if prev != nil && *prev >= node.key {
+			return 0, fmt.Errorf("key %v breaks BST order", node.key)
+		}
+		prev = &node.key
+		rh, err := check(node.right)
+		if err != nil {
+			return 0, err
+		}
+		if lh-rh > 1 || rh-lh > 1 {
+			return 0, fmt.Errorf("key %v has subtree heights %d and %d", node.key, lh, rh)
+		}
+		if node.level != max(lh, rh)+1 {
+			return 0, fmt.Errorf("key %v has level %d, want %d", node.key, node.level, max(lh, rh)+1)
+		}
+		if size := node.left.len() + node.right.len() + node.count; node.size != size {
+			return 0, fmt.Errorf("key %v has size %d, want %d", node.key, node.size, size)
+		}
+		return node.level, nil
+	}
+	_, err := check(tree)
+	return err
+}
+
+func TestAvlTreeOrderStatistics(t *testing.T) {
+	// GIVEN
+	tree := newIntAvlTree(50, 20, 80, 10, 30, 70, 90, 60)
+
+	// WHEN
+	rank := tree.Rank(55)
+	k, ok := tree.Select(3)
+	count := tree.CountRange(20, 70)
+	median, _ := tree.Median()
+
+	// THEN
+	if rank != 4 {
+		t.Errorf("Rank(55) = %d, want 4", rank)
+	}
+	if !ok || k != 50 {
+		t.Errorf("Select(3) = %d, %v, want 50, true", k, ok)
+	}
+	if count != 4 {
+		t.Errorf("CountRange(20, 70) = %d, want 4", count)
+	}
+	if median != 50 {
+		t.Errorf("Median() = %d, want 50", median)
+	}
+	if _, ok := tree.Select(8); ok {
+		t.Error("Select(8) should return false")
+	}
+	if _, ok := tree.Select(-1); ok {
+		t.Error("Select(-1) should return false")
+	}
+	var empty *AVLNode[int, struct{}]
+	if _, ok := empty.Median(); ok {
+		t.Error("Median() of empty tree should return false")
+	}
+}
+
+func TestAvlTreeOrderStatisticsRandomly(t *testing.T) {
+	// GIVEN
+	r := rand.New(rand.NewSource(36))
+	var tree *AVLNode[int, struct{}]
+	model := make(map[int]bool)
+
+	// WHEN
+	for i := 0; i < 3000; i++ {
+		k := r.Intn(500)
+		if r.Intn(3) == 0 {
+			tree = tree.Delete(k)
+			delete(model, k)
+		} else {
+			tree = tree.Insert(k)
+			model[k] = true
+		}
+	}
+
+	// THEN
+	if err := checkAvlTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	var sorted []int
+	for k := 0; k < 500; k++ {
+		if model[k] {
+			sorted = append(sorted, k)
+		}
+	}
+	for i, k := range sorted {
+		if got, _ := tree.Select(i); got != k {
+			t.Fatalf("Select(%d) = %d, want %d", i, got, k)
+		}
+		if got := tree.Rank(k); got != i {
+			t.Fatalf("Rank(%d) = %d, want %d", k, got, i)
+		}
+	}
+	want := 0
+	for k := 100; k < 200; k++ {
+		if model[k] {
+			want++
+		}
+	}
+	if got := tree.CountRange(100, 200); got != want {
+		t.Errorf("CountRange(100, 200) = %d, want %d", got, want)
+	}
+	if median, _ := tree.Median(); median != sorted[(len(sorted)-1)/2] {
+		t.Errorf("Median() = %d, want %d", median, sorted[(len(sorted)-1)/2])
+	}
+}
+
+func TestAvlMultiset(t *testing.T) {
+	// GIVEN
+	s := NewAVLMultiset[int]()
+	for _, k := range []int{5, 3, 5, 8, 5, 3, 1} {
+		s.Add(k)
+	}
+
+	// WHEN
+	deletedOne := s.DeleteOne(5)
+	deletedAll := s.DeleteAll(3)
+	notDeleted := s.DeleteOne(42)
+
+	// THEN
+	if !deletedOne || deletedAll != 2 || notDeleted {
+		t.Errorf("DeleteOne(5), DeleteAll(3), DeleteOne(42) = %v, %d, %v, want true, 2, false",
+			deletedOne, deletedAll, notDeleted)
+	}
+	if s.Count(5) != 2 || s.Count(3) != 0 || s.Count(1) != 1 {
+		t.Errorf("Count(5), Count(3), Count(1) = %d, %d, %d, want 2, 0, 1", s.Count(5), s.Count(3), s.Count(1))
+	}
+	if s.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", s.Len())
+	}
+	var keys []int
+	s.Ascend(func(k int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if want := []int{1, 5, 5, 8}; !equalInts(keys, want) {
+		t.Errorf("Ascend() visits %v, want %v", keys, want)
+	}
+	if r := s.Rank(8); r != 3 {
+		t.Errorf("Rank(8) = %d, want 3", r)
+	}
+	if k, _ := s.Select(2); k != 5 {
+		t.Errorf("Select(2) = %d, want 5", k)
+	}
+}
+
+func TestAvlMultisetRandomly(t *testing.T) {
+	// GIVEN
+	r := rand.New(rand.NewSource(39))
+	var s AVLMultiset[int]
+	model := make(map[int]int)
+
+	// WHEN
+	for i := 0; i < 5000; i++ {
+		k := r.Intn(100)
+		switch r.Intn(5) {
+		case 0:
+			s.DeleteOne(k)
+			if model[k] > 0 {
+				model[k]--
+			}
+		case 1:
+			if n := s.DeleteAll(k); n != model[k] {
+				t.Fatalf("DeleteAll(%d) = %d, want %d", k, n, model[k])
+			}
+			model[k] = 0
+		default:
+			s.Add(k)
+			model[k]++
+		}
+	}
+
+	// THEN
+	if err := checkAvlTree(s.root); err != nil {
+		t.Fatal(err)
+	}
+	var want []int
+	for k := 0; k < 100; k++ {
+		if s.Count(k) != model[k] {
+			t.Fatalf("Count(%d) = %d, want %d", k, s.Count(k), model[k])
+		}
+		if s.Rank(k) != len(want) {
+			t.Fatalf("Rank(%d) = %d, want %d", k, s.Rank(k), len(want))
+		}
+		for j := 0; j < model[k]; j++ {
+			want = append(want, k)
+		}
+	}
+	var got []int
+	it := s.root.ReverseIterator()
+	for k, ok := it.Next(); ok; k, ok = it.Next() {
+		got = append([]int{k}, got...)
+	}
+	if !equalInts(got, want) {
+		t.Fatalf("ReverseIterator() visits %d keys, want %d", len(got), len(want))
+	}
+	for i, k := range want {
+		if sk, _ := s.Select(i); sk != k {
+			t.Fatalf("Select(%d) = %d, want %d", i, sk, k)
+		}
+	}
+}
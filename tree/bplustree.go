@@ -0,0 +1,522 @@
+package tree
+
+import (
+	"errors"
+
+	"golang.org/x/exp/constraints"
+)
+
+// ErrInvalidFanout is returned when creating a B+ tree with an internal fanout
+// less than 3 or a leaf capacity less than 2.
+var ErrInvalidFanout = errors.New("tree: fanout of B+ tree must be at least 3 and leaf capacity at least 2")
+
+// bpNode is the node of the B+ tree. An internal node has one more child than
+// keys, keys[i] separates children[i] and children[i+1]: the keys in
+// children[i] are less than keys[i], and the keys in children[i+1] are not
+// less than it. A leaf holds the keys with their values, and it's linked to
+// its neighbours by prev and next, so a scan never goes back to the parent.
+type bpNode[K constraints.Ordered, V any] struct {
+	keys     []K
+	children []*bpNode[K, V]
+	values   []V
+	prev     *bpNode[K, V]
+	next     *bpNode[K, V]
+	isLeaf   bool
+}
+
+// BPlusTree is a B+ tree, all values are stored in the leaves and the internal
+// nodes only hold separator keys. The fanout is the maximum number of children
+// of an internal node, the leaf capacity is the maximum number of keys in a
+// leaf, every node except the root is at least half full.
+type BPlusTree[K constraints.Ordered, V any] struct {
+	root    *bpNode[K, V]
+	fanout  int
+	leafCap int
+	size    int
+	height  int
+}
+
+// NewBPlusTree returns a new empty B+ tree with the internal fanout and the
+// leaf capacity, it returns ErrInvalidFanout if the fanout is less than 3 or
+// the leaf capacity is less than 2.
+func NewBPlusTree[K constraints.Ordered, V any](fanout, leafCap int) (*BPlusTree[K, V], error) {
+	if fanout < 3 || leafCap < 2 {
+		return nil, ErrInvalidFanout
+	}
+	return &BPlusTree[K, V]{fanout: fanout, leafCap: leafCap}, nil
+}
+
+// Len returns the number of keys in the B+ tree.
+func (tree *BPlusTree[K, V]) Len() int {
+	return tree.size
+}
+
+// Height returns the number of levels of the B+ tree, which is 0 for an empty
+// tree and 1 for a tree with only one leaf.
+func (tree *BPlusTree[K, V]) Height() int {
+	return tree.height
+}
+
+// Get returns the value of the key, the second result is false if the key is
+// not in the B+ tree.
+func (tree *BPlusTree[K, V]) Get(k K) (V, bool) {
+	var zero V
+	if tree.root == nil {
+		return zero, false
+	}
+	leaf := tree.root.findLeaf(k)
+	i, found := leaf.index(k)
+	if !found {
+		return zero, false
+	}
+	return leaf.values[i], true
+}
+
+// Has reports whether the key is in the B+ tree.
+func (tree *BPlusTree[K, V]) Has(k K) bool {
+	_, ok := tree.Get(k)
+	return ok
+}
+
+// Put inserts the key with the value into the B+ tree, if the key is already in
+// the B+ tree, its value is replaced. An overflowed node is split after
+// inserting into it, and when the root is split, a new root is added above.
+func (tree *BPlusTree[K, V]) Put(k K, v V) {
+	if tree.root == nil {
+		tree.root = &bpNode[K, V]{isLeaf: true}
+		tree.height = 1
+	}
+	inserted, sep, right := tree.put(tree.root, k, v)
+	if inserted {
+		tree.size++
+	}
+	if right != nil {
+		tree.root = &bpNode[K, V]{
+			keys:     []K{sep},
+			children: []*bpNode[K, V]{tree.root, right},
+		}
+		tree.height++
+	}
+}
+
+// put inserts the key with the value into the subtree of the node, and reports
+// whether the key is new. If the node is split, the separator key and the new
+// right node are returned for the parent.
+func (tree *BPlusTree[K, V]) put(node *bpNode[K, V], k K, v V) (bool, K, *bpNode[K, V]) {
+	var sep K
+	if node.isLeaf {
+		i, found := node.index(k)
+		if found {
+			node.values[i] = v
+			return false, sep, nil
+		}
+		node.keys = insertAt(node.keys, i, k)
+		node.values = insertAt(node.values, i, v)
+		if len(node.keys) <= tree.leafCap {
+			return true, sep, nil
+		}
+		sep, right := node.splitLeaf()
+		return true, sep, right
+	}
+	i := node.childIndex(k)
+	inserted, childSep, child := tree.put(node.children[i], k, v)
+	if child == nil {
+		return inserted, sep, nil
+	}
+	node.keys = insertAt(node.keys, i, childSep)
+	node.children = insertAt(node.children, i+1, child)
+	if len(node.children) <= tree.fanout {
+		return inserted, sep, nil
+	}
+	sep, right := node.splitInternal()
+	return inserted, sep, right
+}
+
+// splitLeaf moves the upper half of the leaf to a new leaf linked after it,
+// and returns the first key of the new leaf as the separator.
+func (leaf *bpNode[K, V]) splitLeaf() (K, *bpNode[K, V]) {
+	mid := len(leaf.keys) / 2
+	right := &bpNode[K, V]{
+		keys:   append([]K(nil), leaf.keys[mid:]...),
+		values: append([]V(nil), leaf.values[mid:]...),
+		prev:   leaf,
+		next:   leaf.next,
+		isLeaf: true,
+	}
+	leaf.keys = truncate(leaf.keys, mid)
+	leaf.values = truncate(leaf.values, mid)
+	if leaf.next != nil {
+		leaf.next.prev = right
+	}
+	leaf.next = right
+	return right.keys[0], right
+}
+
+// splitInternal moves the upper half of the children to a new node, the key
+// between the two halves moves up to the parent as the separator.
+func (node *bpNode[K, V]) splitInternal() (K, *bpNode[K, V]) {
+	mid := len(node.children) / 2
+	sep := node.keys[mid-1]
+	right := &bpNode[K, V]{
+		keys:     append([]K(nil), node.keys[mid:]...),
+		children: append([]*bpNode[K, V](nil), node.children[mid:]...),
+	}
+	node.keys = truncate(node.keys, mid-1)
+	node.children = truncate(node.children, mid)
+	return sep, right
+}
+
+// Delete deletes the key from the B+ tree and reports whether it was present.
+// An underflowed node borrows from a sibling or is merged with a sibling, and
+// when the root has only one child left, the child becomes the new root.
+func (tree *BPlusTree[K, V]) Delete(k K) bool {
+	if tree.root == nil || !tree.delete(tree.root, k) {
+		return false
+	}
+	tree.size--
+	if tree.root.isLeaf && len(tree.root.keys) == 0 {
+		tree.root = nil
+		tree.height = 0
+	} else if !tree.root.isLeaf && len(tree.root.children) == 1 {
+		tree.root = tree.root.children[0]
+		tree.height--
+	}
+	return true
+}
+
+// delete deletes the key from the subtree of the node, and reports whether the
+// key is found. The underflowed child is fixed by the node after deleting, so
+// only the root may be less than half full.
+func (tree *BPlusTree[K, V]) delete(node *bpNode[K, V], k K) bool {
+	if node.isLeaf {
+		i, found := node.index(k)
+		if !found {
+			return false
+		}
+		node.keys = removeAt(node.keys, i)
+		node.values = removeAt(node.values, i)
+		return true
+	}
+	i := node.childIndex(k)
+	if !tree.delete(node.children[i], k) {
+		return false
+	}
+	child := node.children[i]
+	if child.isLeaf && len(child.keys) < tree.minLeafKeys() {
+		tree.fixLeaf(node, i)
+	} else if !child.isLeaf && len(child.children) < tree.minChildren() {
+		tree.fixInternal(node, i)
+	}
+	return true
+}
+
+// minLeafKeys returns the minimum number of keys in a leaf except the root.
+func (tree *BPlusTree[K, V]) minLeafKeys() int {
+	return (tree.leafCap + 1) / 2
+}
+
+// minChildren returns the minimum number of children of an internal node
+// except the root.
+func (tree *BPlusTree[K, V]) minChildren() int {
+	return (tree.fanout + 1) / 2
+}
+
+// fixLeaf fixes the underflowed i-th child of the parent which is a leaf. It
+// borrows a key from the left or the right sibling if the sibling has more
+// than the minimum, otherwise it merges with one of them.
+func (tree *BPlusTree[K, V]) fixLeaf(parent *bpNode[K, V], i int) {
+	leaf := parent.children[i]
+	if i > 0 {
+		left := parent.children[i-1]
+		if len(left.keys) > tree.minLeafKeys() {
+			last := len(left.keys) - 1
+			leaf.keys = insertAt(leaf.keys, 0, left.keys[last])
+			leaf.values = insertAt(leaf.values, 0, left.values[last])
+			left.keys = truncate(left.keys, last)
+			left.values = truncate(left.values, last)
+			parent.keys[i-1] = leaf.keys[0]
+			return
+		}
+	}
+	if i < len(parent.children)-1 {
+		right := parent.children[i+1]
+		if len(right.keys) > tree.minLeafKeys() {
+			leaf.keys = append(leaf.keys, right.keys[0])
+			leaf.values = append(leaf.values, right.values[0])
+			right.keys = removeAt(right.keys, 0)
+			right.values = removeAt(right.values, 0)
+			parent.keys[i] = right.keys[0]
+			return
+		}
+	}
+	if i > 0 {
+		i--
+	}
+	// merge the (i+1)-th child into the i-th child
+	left, right := parent.children[i], parent.children[i+1]
+	left.keys = append(left.keys, right.keys...)
+	left.values = append(left.values, right.values...)
+	left.next = right.next
+	if right.next != nil {
+		right.next.prev = left
+	}
+	parent.keys = removeAt(parent.keys, i)
+	parent.children = removeAt(parent.children, i+1)
+}
+
+// fixInternal fixes the underflowed i-th child of the parent which is an
+// internal node. A child is borrowed by rotating it through the separator key
+// of the parent, or the child is merged with a sibling and the separator key.
+func (tree *BPlusTree[K, V]) fixInternal(parent *bpNode[K, V], i int) {
+	node := parent.children[i]
+	if i > 0 {
+		left := parent.children[i-1]
+		if len(left.children) > tree.minChildren() {
+			last := len(left.children) - 1
+			node.keys = insertAt(node.keys, 0, parent.keys[i-1])
+			node.children = insertAt(node.children, 0, left.children[last])
+			parent.keys[i-1] = left.keys[last-1]
+			left.keys = truncate(left.keys, last-1)
+			left.children = truncate(left.children, last)
+			return
+		}
+	}
+	if i < len(parent.children)-1 {
+		right := parent.children[i+1]
+		if len(right.children) > tree.minChildren() {
+			node.keys = append(node.keys, parent.keys[i])
+			node.children = append(node.children, right.children[0])
+			parent.keys[i] = right.keys[0]
+			right.keys = removeAt(right.keys, 0)
+			right.children = removeAt(right.children, 0)
+			return
+		}
+	}
+	if i > 0 {
+		i--
+	}
+	// merge the (i+1)-th child and the separator key into the i-th child
+	left, right := parent.children[i], parent.children[i+1]
+	left.keys = append(append(left.keys, parent.keys[i]), right.keys...)
+	left.children = append(left.children, right.children...)
+	parent.keys = removeAt(parent.keys, i)
+	parent.children = removeAt(parent.children, i+1)
+}
+
+// findLeaf returns the leaf which the key belongs to.
+func (node *bpNode[K, V]) findLeaf(k K) *bpNode[K, V] {
+	for !node.isLeaf {
+		node = node.children[node.childIndex(k)]
+	}
+	return node
+}
+
+// childIndex returns the index of the child which the key belongs to, it's
+// the number of separator keys not greater than the key.
+func (node *bpNode[K, V]) childIndex(k K) int {
+	lo, hi := 0, len(node.keys)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if node.keys[mid] <= k {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// index returns the index of the first key not less than k in the leaf, and
+// reports whether the key at the index equals k.
+func (node *bpNode[K, V]) index(k K) (int, bool) {
+	lo, hi := 0, len(node.keys)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if node.keys[mid] < k {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(node.keys) && node.keys[lo] == k
+}
+
+// first returns the leftmost leaf of the subtree.
+func (node *bpNode[K, V]) first() *bpNode[K, V] {
+	for !node.isLeaf {
+		node = node.children[0]
+	}
+	return node
+}
+
+// last returns the rightmost leaf of the subtree.
+func (node *bpNode[K, V]) last() *bpNode[K, V] {
+	for !node.isLeaf {
+		node = node.children[len(node.children)-1]
+	}
+	return node
+}
+
+// insertAt inserts the item into the slice at i.
+func insertAt[T any](s []T, i int, item T) []T {
+	var zero T
+	s = append(s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = item
+	return s
+}
+
+// removeAt removes the item at i from the slice, the vacated last slot is
+// zeroed so it doesn't hold the item.
+func removeAt[T any](s []T, i int) []T {
+	copy(s[i:], s[i+1:])
+	return truncate(s, len(s)-1)
+}
+
+// truncate shortens the slice to n items, the items after n are zeroed.
+func truncate[T any](s []T, n int) []T {
+	var zero T
+	for i := n; i < len(s); i++ {
+		s[i] = zero
+	}
+	return s[:n]
+}
+
+// BPlusCursor is a cursor over the keys of a B+ tree. It moves along the
+// linked leaves, so Next and Prev take O(1) amortized time. The cursor is
+// invalid after the B+ tree is modified, it must be positioned again by one
+// of the Seek methods.
+type BPlusCursor[K constraints.Ordered, V any] struct {
+	tree *BPlusTree[K, V]
+	leaf *bpNode[K, V]
+	i    int
+}
+
+// Cursor returns a new cursor of the B+ tree, it's not positioned until one
+// of the Seek methods is called.
+func (tree *BPlusTree[K, V]) Cursor() *BPlusCursor[K, V] {
+	return &BPlusCursor[K, V]{tree: tree}
+}
+
+// Seek positions the cursor at the first key not less than k, and reports
+// whether there is such a key.
+func (c *BPlusCursor[K, V]) Seek(k K) bool {
+	c.leaf = nil
+	if c.tree.root == nil {
+		return false
+	}
+	c.leaf = c.tree.root.findLeaf(k)
+	c.i, _ = c.leaf.index(k)
+	if c.i == len(c.leaf.keys) {
+		// the key is greater than all keys in the leaf, move to the next leaf
+		c.i--
+		return c.Next()
+	}
+	return true
+}
+
+// SeekFirst positions the cursor at the minimum key, and reports whether the
+// B+ tree is not empty.
+func (c *BPlusCursor[K, V]) SeekFirst() bool {
+	c.leaf = nil
+	if c.tree.root == nil {
+		return false
+	}
+	c.leaf, c.i = c.tree.root.first(), 0
+	return true
+}
+
+// SeekLast positions the cursor at the maximum key, and reports whether the
+// B+ tree is not empty.
+func (c *BPlusCursor[K, V]) SeekLast() bool {
+	c.leaf = nil
+	if c.tree.root == nil {
+		return false
+	}
+	c.leaf = c.tree.root.last()
+	c.i = len(c.leaf.keys) - 1
+	return true
+}
+
+// Valid reports whether the cursor is positioned at a key.
+func (c *BPlusCursor[K, V]) Valid() bool {
+	return c.leaf != nil
+}
+
+// Key returns the key at the cursor, the cursor must be valid.
+func (c *BPlusCursor[K, V]) Key() K {
+	return c.leaf.keys[c.i]
+}
+
+// Value returns the value at the cursor, the cursor must be valid.
+func (c *BPlusCursor[K, V]) Value() V {
+	return c.leaf.values[c.i]
+}
+
+// Next moves the cursor to the next key, and reports whether the cursor is
+// still valid.
+func (c *BPlusCursor[K, V]) Next() bool {
+	if c.leaf == nil {
+		return false
+	}
+	c.i++
+	for c.leaf != nil && c.i == len(c.leaf.keys) {
+		c.leaf, c.i = c.leaf.next, 0
+	}
+	return c.leaf != nil
+}
+
+// Prev moves the cursor to the previous key, and reports whether the cursor
+// is still valid.
+func (c *BPlusCursor[K, V]) Prev() bool {
+	if c.leaf == nil {
+		return false
+	}
+	c.i--
+	for c.leaf != nil && c.i < 0 {
+		c.leaf = c.leaf.prev
+		if c.leaf != nil {
+			c.i = len(c.leaf.keys) - 1
+		}
+	}
+	return c.leaf != nil
+}
+
+// Ascend calls f for every key and value in ascending order until f returns
+// false.
+func (tree *BPlusTree[K, V]) Ascend(f func(k K, v V) bool) {
+	c := tree.Cursor()
+	for ok := c.SeekFirst(); ok && f(c.Key(), c.Value()); ok = c.Next() {
+	}
+}
+
+// Descend calls f for every key and value in descending order until f returns
+// false.
+func (tree *BPlusTree[K, V]) Descend(f func(k K, v V) bool) {
+	c := tree.Cursor()
+	for ok := c.SeekLast(); ok && f(c.Key(), c.Value()); ok = c.Prev() {
+	}
+}
+
+// Range calls f for every key in [lo, hi) and its value in ascending order
+// until f returns false. It seeks lo once, then scans along the leaves.
+func (tree *BPlusTree[K, V]) Range(lo, hi K, f func(k K, v V) bool) {
+	c := tree.Cursor()
+	for ok := c.Seek(lo); ok && c.Key() < hi && f(c.Key(), c.Value()); ok = c.Next() {
+	}
+}
+
+// ReverseRange calls f for every key in [lo, hi) and its value in descending
+// order until f returns false.
+func (tree *BPlusTree[K, V]) ReverseRange(lo, hi K, f func(k K, v V) bool) {
+	c := tree.Cursor()
+	ok := c.Seek(hi)
+	if ok {
+		ok = c.Prev()
+	} else {
+		// all keys are less than hi
+		ok = c.SeekLast()
+	}
+	for ; ok && c.Key() >= lo && f(c.Key(), c.Value()); ok = c.Prev() {
+	}
+}
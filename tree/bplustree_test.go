@@ -0,0 +1,320 @@
+package tree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"golang.org/x/exp/constraints"
+)
+
+// fanouts are the pairs of internal fanout and leaf capacity which the B+ tree
+// tests run across.
+var fanouts = [][2]int{{3, 2}, {4, 3}, {5, 8}, {16, 4}, {64, 64}}
+
+// checkBPlusTree checks the B+ tree invariants: every node except the root is
+// at least half full and not over full, separator keys bound the keys of the
+// children, all leaves are at the same depth, the linked leaves hold all keys
+// in order, and Len and Height match the nodes.
+func checkBPlusTree[K constraints.Ordered, V any](tree *BPlusTree[K, V]) error {
+	if tree.root == nil {
+		if tree.size != 0 || tree.height != 0 {
+			return fmt.Errorf("empty tree has Len() = %d and Height() = %d", tree.size, tree.height)
+		}
+		return nil
+	}
+	leafDepth := -1
+	var leaves []*bpNode[K, V]
+	var check func(node *bpNode[K, V], depth int, lo, hi *K) error
+	check = func(node *bpNode[K, V], depth int, lo, hi *K) error {
+		for i, k := range node.keys {
+			if i > 0 && node.keys[i-1] >= k {
+				return fmt.Errorf("key %v breaks order at depth %d", k, depth)
+			}
+			if (lo != nil && k < *lo) || (hi != nil && k >= *hi) {
+				return fmt.Errorf("key %v is out of the separators at depth %d", k, depth)
+			}
+		}
+		if node.isLeaf {
+			if len(node.values) != len(node.keys) {
+				return fmt.Errorf("leaf has %d keys and %d values", len(node.keys), len(node.values))
+			}
+			if len(node.keys) > tree.leafCap || (node != tree.root && len(node.keys) < tree.minLeafKeys()) {
+				return fmt.Errorf("leaf at depth %d has %d keys", depth, len(node.keys))
+			}
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if leafDepth != depth {
+				return fmt.Errorf("leaves at depth %d and %d", leafDepth, depth)
+			}
+			leaves = append(leaves, node)
+			return nil
+		}
+		n := len(node.children)
+		if n != len(node.keys)+1 {
+			return fmt.Errorf("node at depth %d has %d keys and %d children", depth, len(node.keys), n)
+		}
+		if n > tree.fanout || (node != tree.root && n < tree.minChildren()) || n < 2 {
+			return fmt.Errorf("node at depth %d has %d children", depth, n)
+		}
+		for i, child := range node.children {
+			clo, chi := lo, hi
+			if i > 0 {
+				clo = &node.keys[i-1]
+			}
+			if i < len(node.keys) {
+				chi = &node.keys[i]
+			}
+			if err := check(child, depth+1, clo, chi); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(tree.root, 1, nil, nil); err != nil {
+		return err
+	}
+	count := 0
+	for i, leaf := range leaves {
+		count += len(leaf.keys)
+		var prev, next *bpNode[K, V]
+		if i > 0 {
+			prev = leaves[i-1]
+		}
+		if i < len(leaves)-1 {
+			next = leaves[i+1]
+		}
+		if leaf.prev != prev || leaf.next != next {
+			return fmt.Errorf("leaf %d is not linked to its neighbours", i)
+		}
+	}
+	if count != tree.size {
+		return fmt.Errorf("Len() = %d, want %d", tree.size, count)
+	}
+	if leafDepth != tree.height {
+		return fmt.Errorf("Height() = %d, want %d", tree.height, leafDepth)
+	}
+	return nil
+}
+
+// newIntBPlusTree returns a B+ tree with the keys from 0 to n-1, the value of
+// every key is ten times the key.
+func newIntBPlusTree(fanout, leafCap, n int) *BPlusTree[int, int] {
+	tree, _ := NewBPlusTree[int, int](fanout, leafCap)
+	for _, k := range rand.New(rand.NewSource(int64(n))).Perm(n) {
+		tree.Put(k, k*10)
+	}
+	return tree
+}
+
+func TestNewBPlusTreeValidatesFanout(t *testing.T) {
+	for _, c := range [][2]int{{2, 4}, {4, 1}, {0, 0}} {
+		if _, err := NewBPlusTree[int, int](c[0], c[1]); err != ErrInvalidFanout {
+			t.Errorf("NewBPlusTree(%d, %d) = %v, want ErrInvalidFanout", c[0], c[1], err)
+		}
+	}
+	if _, err := NewBPlusTree[int, int](3, 2); err != nil {
+		t.Errorf("NewBPlusTree(3, 2) = %v, want nil", err)
+	}
+}
+
+func TestBPlusTreePutAndGet(t *testing.T) {
+	for _, f := range fanouts {
+		// GIVEN
+		tree := newIntBPlusTree(f[0], f[1], 1000)
+
+		// WHEN
+		tree.Put(500, -1)
+
+		// THEN
+		if err := checkBPlusTree(tree); err != nil {
+			t.Fatalf("fanout = %v: %v", f, err)
+		}
+		if tree.Len() != 1000 {
+			t.Errorf("fanout = %v, Len() = %d, want 1000", f, tree.Len())
+		}
+		for k := 0; k < 1000; k++ {
+			want := k * 10
+			if k == 500 {
+				want = -1
+			}
+			if v, ok := tree.Get(k); !ok || v != want {
+				t.Fatalf("fanout = %v, Get(%d) = %d, %v, want %d, true", f, k, v, ok, want)
+			}
+		}
+		if tree.Has(1000) || tree.Has(-1) {
+			t.Errorf("fanout = %v, Has() should return false for missing keys", f)
+		}
+	}
+}
+
+func TestBPlusTreeRandomPutAndDelete(t *testing.T) {
+	for _, f := range fanouts {
+		// GIVEN
+		r := rand.New(rand.NewSource(int64(f[0]*100 + f[1])))
+		tree, _ := NewBPlusTree[int, int](f[0], f[1])
+		model := make(map[int]int)
+
+		// WHEN
+		for i := 0; i < 20000; i++ {
+			k := r.Intn(800)
+			if r.Intn(2) == 0 {
+				_, exist := model[k]
+				if ok := tree.Delete(k); ok != exist {
+					t.Fatalf("fanout = %v, Delete(%d) = %v, want %v", f, k, ok, exist)
+				}
+				delete(model, k)
+			} else {
+				tree.Put(k, i)
+				model[k] = i
+			}
+
+			// THEN
+			if err := checkBPlusTree(tree); err != nil {
+				t.Fatalf("fanout = %v, after operation %d on key %d: %v", f, i, k, err)
+			}
+		}
+		for k := 0; k < 800; k++ {
+			v, ok := tree.Get(k)
+			if want, exist := model[k]; ok != exist || v != want {
+				t.Fatalf("fanout = %v, Get(%d) = %d, %v, want %d, %v", f, k, v, ok, want, exist)
+			}
+		}
+	}
+}
+
+func TestBPlusTreeDeleteAll(t *testing.T) {
+	// GIVEN
+	tree := newIntBPlusTree(4, 3, 300)
+
+	// WHEN
+	for k := 299; k >= 0; k-- {
+		if !tree.Delete(k) {
+			t.Fatalf("Delete(%d) should return true", k)
+		}
+	}
+
+	// THEN
+	if err := checkBPlusTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Len() != 0 || tree.Height() != 0 || tree.root != nil {
+		t.Errorf("Len() = %d, Height() = %d, want an empty tree", tree.Len(), tree.Height())
+	}
+	if tree.Delete(0) {
+		t.Error("Delete(0) of empty tree should return false")
+	}
+}
+
+func TestBPlusCursorSeekNextAndPrev(t *testing.T) {
+	// GIVEN
+	tree, _ := NewBPlusTree[int, string](3, 2)
+	for k := 0; k < 100; k += 2 {
+		tree.Put(k, fmt.Sprint(k))
+	}
+	c := tree.Cursor()
+
+	// WHEN
+	ok := c.Seek(31)
+
+	// THEN
+	if !ok || c.Key() != 32 || c.Value() != "32" {
+		t.Fatalf("Seek(31) = %v, key = %v, want true, 32", ok, c.Key())
+	}
+	for want := 34; want < 100; want += 2 {
+		if !c.Next() || c.Key() != want {
+			t.Fatalf("Next() = %v, want %d", c.Key(), want)
+		}
+	}
+	if c.Next() || c.Valid() {
+		t.Error("Next() after the maximum key should return false")
+	}
+	if !c.Seek(98) || c.Key() != 98 {
+		t.Fatalf("Seek(98) should be positioned at 98")
+	}
+	for want := 96; want >= 0; want -= 2 {
+		if !c.Prev() || c.Key() != want {
+			t.Fatalf("Prev() = %v, want %d", c.Key(), want)
+		}
+	}
+	if c.Prev() {
+		t.Error("Prev() before the minimum key should return false")
+	}
+	if c.Seek(99) {
+		t.Error("Seek(99) should return false")
+	}
+	if !c.SeekFirst() || c.Key() != 0 {
+		t.Error("SeekFirst() should be positioned at 0")
+	}
+	if !c.SeekLast() || c.Key() != 98 {
+		t.Error("SeekLast() should be positioned at 98")
+	}
+}
+
+func TestBPlusCursorOfEmptyTree(t *testing.T) {
+	tree, _ := NewBPlusTree[int, int](3, 2)
+	c := tree.Cursor()
+	if c.Seek(0) || c.SeekFirst() || c.SeekLast() || c.Next() || c.Prev() || c.Valid() {
+		t.Error("cursor of empty tree should never be valid")
+	}
+}
+
+func TestBPlusTreeAscendAndDescend(t *testing.T) {
+	// GIVEN
+	tree := newIntBPlusTree(5, 8, 200)
+
+	// WHEN
+	var asc, desc []int
+	tree.Ascend(func(k, v int) bool {
+		asc = append(asc, k)
+		return true
+	})
+	tree.Descend(func(k, v int) bool {
+		desc = append(desc, k)
+		return len(desc) < 10
+	})
+
+	// THEN
+	if len(asc) != 200 || !sort.IntsAreSorted(asc) {
+		t.Errorf("Ascend() = %v, want 0 to 199", asc)
+	}
+	want := []int{199, 198, 197, 196, 195, 194, 193, 192, 191, 190}
+	if !equalInts(desc, want) {
+		t.Errorf("Descend() = %v, want %v", desc, want)
+	}
+}
+
+func TestBPlusTreeRange(t *testing.T) {
+	tree := newIntBPlusTree(4, 3, 100)
+	cases := []struct {
+		lo, hi int
+		want   []int
+	}{
+		{10, 15, []int{10, 11, 12, 13, 14}},
+		{-5, 3, []int{0, 1, 2}},
+		{97, 200, []int{97, 98, 99}},
+		{50, 50, nil},
+		{150, 200, nil},
+	}
+	for _, c := range cases {
+		var got, reverse []int
+		tree.Range(c.lo, c.hi, func(k, v int) bool {
+			got = append(got, k)
+			return true
+		})
+		tree.ReverseRange(c.lo, c.hi, func(k, v int) bool {
+			reverse = append(reverse, k)
+			return true
+		})
+		if !equalInts(got, c.want) {
+			t.Errorf("Range(%d, %d) = %v, want %v", c.lo, c.hi, got, c.want)
+		}
+		for i, j := 0, len(reverse)-1; i < j; i, j = i+1, j-1 {
+			reverse[i], reverse[j] = reverse[j], reverse[i]
+		}
+		if !equalInts(reverse, c.want) {
+			t.Errorf("ReverseRange(%d, %d) = %v, want reversed %v", c.lo, c.hi, reverse, c.want)
+		}
+	}
+}
@@ -1,173 +1,456 @@
 package tree
 
 import (
+	"errors"
 	"fmt"
 
 	"golang.org/x/exp/constraints"
 )
 
-// Using t to represent the half of degree of the B-tree,
-// which means the maximum number of keys in one node is 2t-1.
-const t = 4
+// Using t to represent the minimum degree, which is the half of the maximum
+// degree of the B-tree, so the maximum number of keys in one node is 2t-1.
+// DefaultDegree is the minimum degree used by the methods of BTNode, BTree
+// sets its own minimum degree at construction.
+const DefaultDegree = 4
+
+// ErrInvalidDegree is returned when creating a B-tree with a minimum degree
+// less than 2.
+var ErrInvalidDegree = errors.New("tree: minimum degree of B-tree must be at least 2")
 
 // Key is the key of the B-tree. It contains metadata for the btree node,
 // name is used to compare the order of keys, value is used to store other
-// information, such as the offset or id of the row, you can add more fields
-// when needed.
-type Key[T constraints.Ordered] struct {
+// information, such as the offset or id of the row.
+type Key[T constraints.Ordered, V any] struct {
 	name  T
-	value int32
+	value V
 }
 
 // lt is used to compare the order of keys.
-func (k Key[T]) lt(other Key[T]) bool {
+func (k Key[T, V]) lt(other Key[T, V]) bool {
 	return k.name < other.name
 }
 
 // BTNode is the node of the B-tree. Keys is the array of keys in the node,
 // which holds comparable values; children are the subnodes for one node;
-// isLeaf is used to indicate whether the node is a leaf node; level is used
-// to record the level of the current node.
-type BTNode[T constraints.Ordered] struct {
-	keys     []Key[T]
-	children []*BTNode[T]
+// isLeaf is used to indicate whether the node is a leaf node. All leaves are
+// at the same depth, so the level of a node is never stored, it's the number
+// of nodes on the path from the root. Cow is the copy-on-write context which
+// owns the node, a BTree only modifies the nodes it owns, and copies the
+// others first.
+type BTNode[T constraints.Ordered, V any] struct {
+	keys     []Key[T, V]
+	children []*BTNode[T, V]
 	isLeaf   bool
-	level    int
+	cow      *copyOnWriteContext
+}
+
+// copyOnWriteContext is the owner of nodes, a node can be modified only by the
+// tree with the same context. Clone gives both trees new contexts, so all
+// nodes existing at that time are shared and copied before being modified by
+// either tree. The field makes every context a distinct pointer.
+type copyOnWriteContext struct {
+	_ byte
+}
+
+// mutableFor returns the node itself if it's owned by the context, otherwise a
+// copy owned by the context. A nil context owns every node, which is the case
+// of the methods of BTNode.
+func (tree *BTNode[T, V]) mutableFor(cow *copyOnWriteContext) *BTNode[T, V] {
+	if cow == nil || tree.cow == cow {
+		return tree
+	}
+	node := &BTNode[T, V]{
+		keys:   append(make([]Key[T, V], 0, cap(tree.keys)), tree.keys...),
+		isLeaf: tree.isLeaf,
+		cow:    cow,
+	}
+	if !tree.isLeaf {
+		node.children = append(make([]*BTNode[T, V], 0, cap(tree.children)), tree.children...)
+	}
+	return node
+}
+
+// mutableChild replaces the i-th child with the one owned by the context, and
+// returns it.
+func (tree *BTNode[T, V]) mutableChild(i int, cow *copyOnWriteContext) *BTNode[T, V] {
+	child := tree.children[i].mutableFor(cow)
+	tree.children[i] = child
+	return child
 }
 
 // Search searches key in the B-tree, which is a recursive process.
-// If the key is found, return the value; otherwise, return -1.
-func (tree *BTNode[T]) Search(k T) int32 {
+// If the key is found, return the value and true; otherwise, return the zero
+// value and false.
+func (tree *BTNode[T, V]) Search(k T) (V, bool) {
 	i := 0
 	for i < len(tree.keys) && k > tree.keys[i].name {
 		i++
 	}
 	if i < len(tree.keys) && k == tree.keys[i].name {
-		return tree.keys[i].value
+		return tree.keys[i].value, true
 	}
 	if tree.isLeaf {
-		return -1
+		var zero V
+		return zero, false
 	}
 	return tree.children[i].Search(k)
 }
 
-// Insert inserts a key into the B-tree, which is used to update the B-tree.
-func (tree *BTNode[T]) Insert(k Key[T]) *BTNode[T] {
-	i := len(tree.keys) - 1
+// Insert inserts a key into the B-tree with the minimum degree DefaultDegree,
+// which is used to update the B-tree, and returns the node holding the key. If
+// the key is already in the B-tree, its value is replaced instead of adding a
+// duplicate key. Only the children on the path are split, the root itself is
+// never split and keeps growing past 2t-1 keys, use BTree to split it and grow
+// in height.
+func (tree *BTNode[T, V]) Insert(k Key[T, V]) *BTNode[T, V] {
+	node, _ := tree.insert(k, DefaultDegree, nil)
+	return node
+}
+
+// growIfFull splits the root if it's full, and returns the new root with the
+// two halves of the old root as its children, and reports whether the tree
+// grows in height. The root must be owned by the context.
+func (tree *BTNode[T, V]) growIfFull(t int, cow *copyOnWriteContext) (*BTNode[T, V], bool) {
+	if len(tree.keys) < 2*t-1 {
+		return tree, false
+	}
+	root := &BTNode[T, V]{children: []*BTNode[T, V]{tree}, isLeaf: false, cow: cow}
+	root.splitChild(0, t, cow)
+	return root, true
+}
+
+// insert inserts a key into the B-tree with the minimum degree t, returns the
+// node holding the key, and reports whether the key is new; if the key is
+// already in the B-tree, only its value is replaced. The node must be owned by
+// the context, and the full child on the path is split before going down, so
+// the children never overflow.
+func (tree *BTNode[T, V]) insert(k Key[T, V], t int, cow *copyOnWriteContext) (*BTNode[T, V], bool) {
+	i := 0
+	for i < len(tree.keys) && tree.keys[i].lt(k) {
+		i++
+	}
+	if i < len(tree.keys) && tree.keys[i].name == k.name {
+		tree.keys[i].value = k.value
+		return tree, false
+	}
 	if tree.isLeaf {
-		tree.keys = append(tree.keys, k)
-		j := i
-		for ; j >= 0 && k.lt(tree.keys[j]); j-- {
-			tree.keys[j+1] = tree.keys[j]
+		tree.keys = append(tree.keys, Key[T, V]{})
+		copy(tree.keys[i+1:], tree.keys[i:])
+		tree.keys[i] = k
+		return tree, true
+	}
+	if len(tree.children[i].keys) == 2*t-1 {
+		tree.splitChild(i, t, cow)
+		// the middle key moved up to i, it may be the key itself
+		if tree.keys[i].name == k.name {
+			tree.keys[i].value = k.value
+			return tree, false
+		}
+		if tree.keys[i].lt(k) {
+			i++
 		}
-		tree.keys[j+1] = k
-		return tree
 	}
-	for i >= 0 && k.lt(tree.keys[i]) {
-		i--
+	return tree.mutableChild(i, cow).insert(k, t, cow)
+}
+
+// splitChild splits the i-th child of the parent when it's full, which has
+// 2t-1 keys. The middle key moves up to the parent at i, the keys and children
+// after it move to a new node which becomes the (i+1)-th child, and the child
+// keeps the first t-1 keys and t children. The parent must be owned by the
+// context.
+func (parent *BTNode[T, V]) splitChild(i int, t int, cow *copyOnWriteContext) {
+	child := parent.mutableChild(i, cow)
+	right := &BTNode[T, V]{
+		keys:   append(make([]Key[T, V], 0, 2*t-1), child.keys[t:]...),
+		isLeaf: child.isLeaf,
+		cow:    cow,
 	}
-	i++
-	if len(tree.children[i].keys) == 2*t-1 {
-		tree.splitChild(i, tree.children[i])
-		// recalculate the index after split BTNode
-		i = len(tree.keys) - 1
-		for i >= 0 && k.lt(tree.keys[i]) {
-			i--
+	middle := child.keys[t-1]
+	// zero the moved keys and children so the child doesn't hold them
+	for j := t - 1; j < len(child.keys); j++ {
+		child.keys[j] = Key[T, V]{}
+	}
+	child.keys = child.keys[:t-1]
+	if !child.isLeaf {
+		right.children = append(make([]*BTNode[T, V], 0, 2*t), child.children[t:]...)
+		for j := t; j < len(child.children); j++ {
+			child.children[j] = nil
 		}
+		child.children = child.children[:t]
+	}
+
+	parent.keys = append(parent.keys, Key[T, V]{})
+	copy(parent.keys[i+1:], parent.keys[i:])
+	parent.keys[i] = middle
+	parent.children = append(parent.children, nil)
+	copy(parent.children[i+2:], parent.children[i+1:])
+	parent.children[i+1] = right
+}
+
+// delete deletes the key from the subtree with the minimum degree t, and
+// reports whether the key is found. It goes down in one pass like insert: the
+// node must have at least t keys unless it is the root, and before going down
+// to a child with only t-1 keys, the child borrows a key from a sibling or is
+// merged with a sibling, so deleting from the child never underflows. The node
+// must be owned by the context.
+func (tree *BTNode[T, V]) delete(k T, t int, cow *copyOnWriteContext) bool {
+	i := 0
+	for i < len(tree.keys) && k > tree.keys[i].name {
 		i++
 	}
-	return tree.children[i].Insert(k)
-}
-
-// Split BTNode when the number of the keys = [2*t-1].
-// In this case, first split the original child into two pieces with the
-// middle key, then constuct a new node with the middle key and two children,
-// finally insert the new node into the parent node.
-func (parent *BTNode[T]) splitChild(i int, child *BTNode[T]) {
-	// split original child into two pieces with the middle Key,
-	// child1, child2 = child[:t-1], child[t:]
-	var child1, child2 *BTNode[T]
-	level := child.level + 1
-	if child.isLeaf {
-		child1 = &BTNode[T]{
-			keys:     child.keys[:t-1],
-			children: nil,
-			isLeaf:   child.isLeaf,
-			level:    level,
+	if i < len(tree.keys) && k == tree.keys[i].name {
+		if tree.isLeaf {
+			tree.keys = append(tree.keys[:i], tree.keys[i+1:]...)
+			return true
 		}
-		child2 = &BTNode[T]{
-			keys:     child.keys[t:],
-			children: nil,
-			isLeaf:   child.isLeaf,
-			level:    level,
+		if len(tree.children[i].keys) >= t {
+			// replace the key with its predecessor, then delete the
+			// predecessor from the left child
+			left := tree.mutableChild(i, cow)
+			pred := left.max()
+			tree.keys[i] = pred
+			return left.delete(pred.name, t, cow)
 		}
-	} else {
-		child1 = &BTNode[T]{
-			keys:     child.keys[:t-1],
-			children: child.children[:t-1],
-			isLeaf:   child.isLeaf,
-			level:    level,
+		if len(tree.children[i+1].keys) >= t {
+			// replace the key with its successor, then delete the successor
+			// from the right child
+			right := tree.mutableChild(i+1, cow)
+			succ := right.min()
+			tree.keys[i] = succ
+			return right.delete(succ.name, t, cow)
 		}
-		child2 = &BTNode[T]{
-			keys:     child.keys[t:],
-			children: child.children[t:],
-			isLeaf:   child.isLeaf,
-			level:    level,
+		// both children have t-1 keys, merge them with the key in between,
+		// then delete the key from the merged child
+		tree.mergeChildren(i, cow)
+		return tree.children[i].delete(k, t, cow)
+	}
+	if tree.isLeaf {
+		return false
+	}
+	if len(tree.children[i].keys) == t-1 {
+		if i > 0 && len(tree.children[i-1].keys) >= t {
+			tree.borrowFromLeft(i, cow)
+		} else if i < len(tree.keys) && len(tree.children[i+1].keys) >= t {
+			tree.borrowFromRight(i, cow)
+		} else if i < len(tree.keys) {
+			tree.mergeChildren(i, cow)
+		} else {
+			tree.mergeChildren(i-1, cow)
+			i--
 		}
 	}
+	return tree.mutableChild(i, cow).delete(k, t, cow)
+}
+
+// borrowFromLeft moves the i-th key of the parent down to the front of the
+// i-th child, and moves the last key of the left sibling up to the parent.
+func (parent *BTNode[T, V]) borrowFromLeft(i int, cow *copyOnWriteContext) {
+	child, left := parent.mutableChild(i, cow), parent.mutableChild(i-1, cow)
+	child.keys = append([]Key[T, V]{parent.keys[i-1]}, child.keys...)
+	parent.keys[i-1] = left.keys[len(left.keys)-1]
+	left.keys = left.keys[:len(left.keys)-1]
+	if !child.isLeaf {
+		child.children = append([]*BTNode[T, V]{left.children[len(left.children)-1]}, child.children...)
+		left.children = left.children[:len(left.children)-1]
+	}
+}
+
+// borrowFromRight moves the i-th key of the parent down to the end of the
+// i-th child, and moves the first key of the right sibling up to the parent.
+func (parent *BTNode[T, V]) borrowFromRight(i int, cow *copyOnWriteContext) {
+	child, right := parent.mutableChild(i, cow), parent.mutableChild(i+1, cow)
+	child.keys = append(child.keys, parent.keys[i])
+	parent.keys[i] = right.keys[0]
+	right.keys = append(right.keys[:0:0], right.keys[1:]...)
+	if !child.isLeaf {
+		child.children = append(child.children, right.children[0])
+		right.children = append(right.children[:0:0], right.children[1:]...)
+	}
+}
 
-	subParent := &BTNode[T]{
-		keys:     []Key[T]{child.keys[t-1]},
-		children: []*BTNode[T]{child1, child2},
-		isLeaf:   false,
-		level:    child.level,
-	}
-	parent.children[i] = subParent
-	parent.merge(subParent, i)
-}
-
-// Merge merges parent and child node when the number of parent's keys < 2*t-1.
-// Child BTNode is the new node after spliting, so it has just one Key and two children.
-// It should be called after splitChild to balance tree.
-func (parent *BTNode[T]) merge(child *BTNode[T], i int) {
-	if len(parent.keys) == 2*t-1 {
-		return
-	}
-	if i == 0 {
-		parent.keys = append(child.keys, parent.keys...)
-		parent.children = append(child.children, parent.children[1:]...)
-	} else if len(parent.keys) > i {
-		// split parent's keys into two pieces, the middle one will be the only one
-		// at child node
-		k1, k2 := parent.keys[:i], parent.keys[i:]
-		keys := make([]Key[T], 0, len(k1)+len(k2)+1)
-		keys = append(keys, k1...)
-		keys = append(keys, child.keys[0])
-		keys = append(keys, k2...)
-		parent.keys = keys
-		// split parent children into two pieces, will ignore the middle one
-		c1, c2 := parent.children[:i], parent.children[i+1:]
-		children := make([]*BTNode[T], 0, len(c1)+len(c2)+1)
-		children = append(children, c1...)
-		children = append(children, child.children...)
-		children = append(children, c2...)
-		parent.children = children
-	} else {
-		// just append the Key and children of child BTNode to parent
-		parent.keys = append(parent.keys, child.keys[0])
-		parent.children = append(parent.children[:i], child.children...)
-	}
-	// update level of children
-	for _, c := range parent.children {
-		c.level = parent.level + 1
-	}
-}
-
-func traverse[T constraints.Ordered](tree *BTNode[T]) {
-	fmt.Printf("level = %d, keys = %+v\n", tree.level, tree.keys)
+// mergeChildren merges the (i+1)-th child and the i-th key of the parent into
+// the i-th child, and removes them from the parent. The right child is only
+// read, so it's not copied even if it's shared.
+func (parent *BTNode[T, V]) mergeChildren(i int, cow *copyOnWriteContext) {
+	left, right := parent.mutableChild(i, cow), parent.children[i+1]
+	keys := make([]Key[T, V], 0, len(left.keys)+len(right.keys)+1)
+	keys = append(keys, left.keys...)
+	keys = append(keys, parent.keys[i])
+	left.keys = append(keys, right.keys...)
+	if !left.isLeaf {
+		children := make([]*BTNode[T, V], 0, len(left.children)+len(right.children))
+		children = append(children, left.children...)
+		left.children = append(children, right.children...)
+	}
+	parent.keys = append(parent.keys[:i], parent.keys[i+1:]...)
+	parent.children = append(parent.children[:i+1], parent.children[i+2:]...)
+}
+
+// min returns the minimum key in the subtree.
+func (tree *BTNode[T, V]) min() Key[T, V] {
+	for !tree.isLeaf {
+		tree = tree.children[0]
+	}
+	return tree.keys[0]
+}
+
+// max returns the maximum key in the subtree.
+func (tree *BTNode[T, V]) max() Key[T, V] {
+	for !tree.isLeaf {
+		tree = tree.children[len(tree.children)-1]
+	}
+	return tree.keys[len(tree.keys)-1]
+}
+
+func traverse[T constraints.Ordered, V any](tree *BTNode[T, V]) {
+	traverseLevel(tree, 1)
+}
+
+func traverseLevel[T constraints.Ordered, V any](tree *BTNode[T, V], level int) {
+	fmt.Printf("level = %d, keys = %+v\n", level, tree.keys)
 	for i := range tree.children {
 		if !tree.isLeaf && tree.children[i] != nil {
-			traverse(tree.children[i])
+			traverseLevel(tree.children[i], level+1)
+		}
+	}
+}
+
+// BTree is a B-tree with its own minimum degree t, every node except the root
+// holds t-1 to 2t-1 keys. A larger degree makes the tree shallower and the
+// nodes wider, such as page-sized nodes for storage. It owns the root, so the
+// root is split or collapsed in place and callers never juggle returned roots.
+//
+// The B-tree is copy-on-write: Clone shares all nodes between the two trees,
+// and a write copies only the nodes on its path which it doesn't own yet.
+type BTree[K constraints.Ordered, V any] struct {
+	root   *BTNode[K, V]
+	t      int
+	size   int
+	height int
+	cow    *copyOnWriteContext
+}
+
+// NewBTree returns a new empty B-tree with the minimum degree t, it returns
+// ErrInvalidDegree if t is less than 2.
+func NewBTree[K constraints.Ordered, V any](t int) (*BTree[K, V], error) {
+	if t < 2 {
+		return nil, ErrInvalidDegree
+	}
+	return &BTree[K, V]{t: t, cow: new(copyOnWriteContext)}, nil
+}
+
+// Clone returns a copy of the B-tree in O(1) time. The two trees share all
+// nodes, and each copies a shared node on its first write to it, so writes to
+// one tree are never seen by the other, and the trees can be used by
+// different goroutines. It's also a snapshot: iterating over the clone is safe
+// while the original keeps changing.
+//
+// Clone itself must not run concurrently with a write to the B-tree.
+func (tree *BTree[K, V]) Clone() *BTree[K, V] {
+	// neither tree owns the shared nodes after cloning
+	clone := *tree
+	tree.cow, clone.cow = new(copyOnWriteContext), new(copyOnWriteContext)
+	return &clone
+}
+
+// Degree returns the minimum degree of the B-tree.
+func (tree *BTree[K, V]) Degree() int {
+	return tree.t
+}
+
+// Len returns the number of keys in the B-tree.
+func (tree *BTree[K, V]) Len() int {
+	return tree.size
+}
+
+// Height returns the number of levels of the B-tree, which is 0 for an empty
+// tree and 1 for a tree with only the root.
+func (tree *BTree[K, V]) Height() int {
+	return tree.height
+}
+
+// Put inserts the key with the value into the B-tree, if the key is already in
+// the B-tree, its value is replaced. A full root is split before going down,
+// which is the only way the tree grows in height.
+func (tree *BTree[K, V]) Put(k K, v V) {
+	if tree.root == nil {
+		tree.root = &BTNode[K, V]{isLeaf: true, cow: tree.cow}
+		tree.height = 1
+	}
+	tree.root = tree.root.mutableFor(tree.cow)
+	root, grown := tree.root.growIfFull(tree.t, tree.cow)
+	if grown {
+		tree.root = root
+		tree.height++
+	}
+	if _, added := tree.root.insert(Key[K, V]{name: k, value: v}, tree.t, tree.cow); added {
+		tree.size++
+	}
+}
+
+// Delete deletes the key from the B-tree and reports whether it was present.
+// When the root runs out of keys after merging its last two children, the
+// merged child becomes the new root, which is the only way the tree shrinks in
+// height.
+func (tree *BTree[K, V]) Delete(k K) bool {
+	if tree.root == nil {
+		return false
+	}
+	tree.root = tree.root.mutableFor(tree.cow)
+	deleted := tree.root.delete(k, tree.t, tree.cow)
+	if deleted {
+		tree.size--
+	}
+	if len(tree.root.keys) == 0 {
+		if tree.root.isLeaf {
+			tree.root = nil
+		} else {
+			tree.root = tree.root.children[0]
+		}
+		tree.height--
+	}
+	return deleted
+}
+
+// Search searches the key in the B-tree, if the key is found, return the value
+// and true; otherwise, return the zero value and false.
+func (tree *BTree[K, V]) Search(k K) (V, bool) {
+	if tree.root == nil {
+		var zero V
+		return zero, false
+	}
+	return tree.root.Search(k)
+}
+
+// Get is the same as Search, it's named after the map-style API.
+func (tree *BTree[K, V]) Get(k K) (V, bool) {
+	return tree.Search(k)
+}
+
+// Has reports whether the key is in the B-tree.
+func (tree *BTree[K, V]) Has(k K) bool {
+	_, ok := tree.Search(k)
+	return ok
+}
+
+// Ascend calls f for every key and value in ascending order until f returns
+// false.
+func (tree *BTree[K, V]) Ascend(f func(k K, v V) bool) {
+	if tree.root != nil {
+		tree.root.ascend(f)
+	}
+}
+
+// ascend calls f for the keys of the subtree in order, and reports whether f
+// returns true for all of them.
+func (tree *BTNode[T, V]) ascend(f func(k T, v V) bool) bool {
+	for i, k := range tree.keys {
+		if !tree.isLeaf && !tree.children[i].ascend(f) {
+			return false
+		}
+		if !f(k.name, k.value) {
+			return false
 		}
 	}
+	return tree.isLeaf || tree.children[len(tree.keys)].ascend(f)
 }
@@ -0,0 +1,173 @@
+package tree
+
+import (
+	"errors"
+
+	"golang.org/x/exp/constraints"
+)
+
+// Errors of bulk loading.
+var (
+	ErrInvalidFillFactor = errors.New("tree: fill factor must be greater than 0 and at most 1")
+	ErrUnsorted          = errors.New("tree: keys of bulk loading must be in strictly ascending order")
+)
+
+// LoadBTree builds a B-tree of minimum degree t from keys sorted in strictly
+// ascending order, values[i] is the value of keys[i]. It panics if the lengths
+// of keys and values differ. See LoadBTreeFunc for the fill factor.
+func LoadBTree[K constraints.Ordered, V any](t int, fill float64, keys []K, values []V) (*BTree[K, V], error) {
+	if len(keys) != len(values) {
+		panic("tree: LoadBTree with different numbers of keys and values")
+	}
+	i := 0
+	return LoadBTreeFunc(t, fill, func() (K, V, bool) {
+		if i == len(keys) {
+			var k K
+			var v V
+			return k, v, false
+		}
+		i++
+		return keys[i-1], values[i-1], true
+	})
+}
+
+// LoadBTreeFunc builds a B-tree of minimum degree t from the keys and values
+// returned by next until it returns false, the keys must be in strictly
+// ascending order. It's much faster than putting the keys one by one, the
+// nodes are built bottom-up from left to right, and only the rightmost node
+// of every level is kept open.
+//
+// Every node is filled to fill times the maximum of 2t-1 keys, except those
+// on the right edge which are balanced with their left siblings at the end.
+// A fill factor below one leaves room for later writes without splitting, and
+// it's rounded up to the minimum of t-1 keys. It returns ErrInvalidDegree,
+// ErrInvalidFillFactor, or ErrUnsorted if a key is not greater than the one
+// before it.
+func LoadBTreeFunc[K constraints.Ordered, V any](t int, fill float64, next func() (K, V, bool)) (*BTree[K, V], error) {
+	tree, err := NewBTree[K, V](t)
+	if err != nil {
+		return nil, err
+	}
+	if !(fill > 0 && fill <= 1) {
+		return nil, ErrInvalidFillFactor
+	}
+	target := int(fill*float64(2*t-1) + 0.5)
+	if target < t-1 {
+		target = t - 1
+	}
+	l := &btreeLoader[K, V]{tree: tree, target: target}
+	l.levels = []*btreeLevel[K, V]{{cur: l.newNode(true)}}
+	for {
+		k, v, ok := next()
+		if !ok {
+			break
+		}
+		if tree.size > 0 && k <= l.last {
+			return nil, ErrUnsorted
+		}
+		l.pushKey(0, Key[K, V]{name: k, value: v})
+		l.last = k
+		tree.size++
+	}
+	l.finish()
+	return tree, nil
+}
+
+// btreeLoader builds a B-tree bottom-up. Every level has the open node cur
+// which is being filled, and the node before it, pending, which is full but
+// not added to its parent yet, with the key sep between them. Pending is only
+// added to its parent when cur is full too, so the last two nodes of a level
+// can still be balanced at the end.
+type btreeLoader[K constraints.Ordered, V any] struct {
+	tree   *BTree[K, V]
+	target int
+	levels []*btreeLevel[K, V]
+	last   K
+}
+
+// btreeLevel is one level of the loader, levels[0] is the leaves.
+type btreeLevel[K constraints.Ordered, V any] struct {
+	pending *BTNode[K, V]
+	sep     Key[K, V]
+	cur     *BTNode[K, V]
+}
+
+// newNode returns an empty node owned by the tree, which has the room of a
+// full node.
+func (l *btreeLoader[K, V]) newNode(leaf bool) *BTNode[K, V] {
+	t := l.tree.t
+	node := &BTNode[K, V]{keys: make([]Key[K, V], 0, 2*t-1), isLeaf: leaf, cow: l.tree.cow}
+	if !leaf {
+		node.children = make([]*BTNode[K, V], 0, 2*t)
+	}
+	return node
+}
+
+// pushKey appends the key to the open node of the level. If the node is full,
+// the key becomes the separator after it, the node becomes pending, and the
+// pending node before it is added to the parent level with its separator.
+func (l *btreeLoader[K, V]) pushKey(level int, k Key[K, V]) {
+	lv := l.levels[level]
+	if len(lv.cur.keys) < l.target {
+		lv.cur.keys = append(lv.cur.keys, k)
+		return
+	}
+	if lv.pending != nil {
+		l.pushChild(level+1, lv.pending)
+		l.pushKey(level+1, lv.sep)
+	}
+	lv.pending, lv.sep, lv.cur = lv.cur, k, l.newNode(level == 0)
+}
+
+// pushChild appends the node to the children of the open node of the level,
+// the level is added if the node is the first one of it.
+func (l *btreeLoader[K, V]) pushChild(level int, node *BTNode[K, V]) {
+	if level == len(l.levels) {
+		l.levels = append(l.levels, &btreeLevel[K, V]{cur: l.newNode(false)})
+	}
+	lv := l.levels[level]
+	lv.cur.children = append(lv.cur.children, node)
+}
+
+// finish closes the levels from the bottom up. The last node of a level may
+// have less than t-1 keys, so it's merged with the pending node if they fit
+// in one node, or they share their keys evenly. The only node of the top
+// level is the root.
+func (l *btreeLoader[K, V]) finish() {
+	t := l.tree.t
+	for level := 0; ; level++ {
+		lv := l.levels[level]
+		if lv.pending == nil {
+			if len(lv.cur.keys) > 0 {
+				l.tree.root, l.tree.height = lv.cur, level+1
+			}
+			return
+		}
+		pending, cur := lv.pending, lv.cur
+		if len(cur.keys) < t-1 {
+			keys := append(append(append(make([]Key[K, V], 0, len(pending.keys)+len(cur.keys)+1), pending.keys...), lv.sep), cur.keys...)
+			children := append(append(make([]*BTNode[K, V], 0, len(keys)+1), pending.children...), cur.children...)
+			if len(keys) <= 2*t-1 {
+				pending.keys = append(pending.keys[:0], keys...)
+				pending.children = append(pending.children[:0], children...)
+				if level == len(l.levels)-1 {
+					l.tree.root, l.tree.height = pending, level+1
+					return
+				}
+				l.pushChild(level+1, pending)
+				continue
+			}
+			m := (len(keys) - 1) / 2
+			pending.keys = append(pending.keys[:0], keys[:m]...)
+			lv.sep = keys[m]
+			cur.keys = append(cur.keys[:0], keys[m+1:]...)
+			if !pending.isLeaf {
+				pending.children = append(pending.children[:0], children[:m+1]...)
+				cur.children = append(cur.children[:0], children[m+1:]...)
+			}
+		}
+		l.pushChild(level+1, pending)
+		l.pushKey(level+1, lv.sep)
+		l.pushChild(level+1, cur)
+	}
+}
@@ -0,0 +1,199 @@
+package tree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// sequence returns the keys 0, 2, 4, ... and their values.
+func sequence(n int) ([]int, []int) {
+	keys, values := make([]int, n), make([]int, n)
+	for i := range keys {
+		keys[i], values[i] = 2*i, i
+	}
+	return keys, values
+}
+
+func TestLoadBTreeBuildsValidTrees(t *testing.T) {
+	for _, degree := range []int{2, 3, 4, 7} {
+		for _, fill := range []float64{0.01, 0.5, 0.7, 1} {
+			for n := 0; n < 400; n++ {
+				// GIVEN
+				keys, values := sequence(n)
+
+				// WHEN
+				tree, err := LoadBTree(degree, fill, keys, values)
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := checkBTree(tree); err != nil {
+					t.Fatalf("t = %d, fill = %v, %d keys: %v", degree, fill, n, err)
+				}
+				got, err := btreeContents(tree)
+				if err != nil || len(got) != n {
+					t.Fatalf("t = %d, fill = %v: tree has %d keys, want %d: %v", degree, fill, len(got), n, err)
+				}
+				for i, k := range keys {
+					if v, ok := got[k]; !ok || v != values[i] {
+						t.Fatalf("t = %d, fill = %v: Get(%d) = %d, %v, want %d", degree, fill, k, v, ok, values[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestLoadBTreeFillFactor(t *testing.T) {
+	cases := []struct {
+		fill float64
+		keys int
+	}{
+		{1, 7},
+		{0.7, 5},
+		{0.5, 4},
+		{0.1, 3},
+	}
+	for _, c := range cases {
+		// GIVEN
+		keys, values := sequence(10000)
+
+		// WHEN
+		tree, _ := LoadBTree(4, c.fill, keys, values)
+
+		// THEN
+		// all nodes but the last two of every level have the same number of
+		// keys
+		full, nodes := 0, 0
+		var walk func(node *BTNode[int, int])
+		walk = func(node *BTNode[int, int]) {
+			nodes++
+			if len(node.keys) == c.keys {
+				full++
+			}
+			for _, child := range node.children {
+				walk(child)
+			}
+		}
+		walk(tree.root)
+		if nodes-full > 2*tree.Height() {
+			t.Errorf("fill = %v: %d of %d nodes have %d keys", c.fill, full, nodes, c.keys)
+		}
+	}
+}
+
+func TestLoadBTreeIsSmallerThanInserting(t *testing.T) {
+	// GIVEN
+	keys, values := sequence(10000)
+	inserted, _ := NewBTree[int, int](4)
+	for i, k := range keys {
+		inserted.Put(k, values[i])
+	}
+
+	// WHEN
+	loaded, _ := LoadBTree(4, 1, keys, values)
+
+	// THEN
+	count := func(tree *BTree[int, int]) int {
+		n := 0
+		var walk func(node *BTNode[int, int])
+		walk = func(node *BTNode[int, int]) {
+			n++
+			for _, child := range node.children {
+				walk(child)
+			}
+		}
+		walk(tree.root)
+		return n
+	}
+	if a, b := count(loaded), count(inserted); a*3 > b*2 {
+		t.Errorf("loaded tree has %d nodes, inserted tree has %d", a, b)
+	}
+	if loaded.Height() > inserted.Height() {
+		t.Errorf("loaded tree has Height() = %d, inserted tree has %d", loaded.Height(), inserted.Height())
+	}
+}
+
+func TestLoadBTreeFuncStreams(t *testing.T) {
+	// GIVEN
+	i := 0
+	next := func() (string, int, bool) {
+		if i == 5000 {
+			return "", 0, false
+		}
+		i++
+		return fmt.Sprintf("key%05d", i), i, true
+	}
+
+	// WHEN
+	tree, err := LoadBTreeFunc(3, 0.8, next)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBTree(tree); err != nil || tree.Len() != 5000 {
+		t.Fatalf("tree has %d keys: %v", tree.Len(), err)
+	}
+	if v, ok := tree.Get("key04321"); !ok || v != 4321 {
+		t.Errorf("Get(key04321) = %d, %v, want 4321", v, ok)
+	}
+}
+
+func TestLoadBTreeThenWrite(t *testing.T) {
+	// GIVEN
+	keys, values := sequence(3000)
+	tree, _ := LoadBTree(3, 0.9, keys, values)
+	model := make(map[int]int)
+	for i, k := range keys {
+		model[k] = values[i]
+	}
+	r := rand.New(rand.NewSource(3))
+
+	// WHEN
+	for i := 0; i < 10000; i++ {
+		k := r.Intn(7000)
+		if r.Intn(2) == 0 {
+			tree.Delete(k)
+			delete(model, k)
+		} else {
+			tree.Put(k, -i)
+			model[k] = -i
+		}
+	}
+
+	// THEN
+	if err := checkBTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	got, err := btreeContents(tree)
+	if err != nil || !equalIntMaps(got, model) {
+		t.Errorf("tree has %d keys, want %d: %v", len(got), len(model), err)
+	}
+}
+
+func TestLoadBTreeValidatesInput(t *testing.T) {
+	cases := []struct {
+		degree int
+		fill   float64
+		keys   []int
+		err    error
+	}{
+		{1, 1, []int{1, 2}, ErrInvalidDegree},
+		{2, 0, []int{1, 2}, ErrInvalidFillFactor},
+		{2, 1.5, []int{1, 2}, ErrInvalidFillFactor},
+		{2, 1, []int{1, 3, 2}, ErrUnsorted},
+		{2, 1, []int{1, 2, 2}, ErrUnsorted},
+	}
+	for _, c := range cases {
+		// WHEN
+		tree, err := LoadBTree(c.degree, c.fill, c.keys, make([]int, len(c.keys)))
+
+		// THEN
+		if tree != nil || err != c.err {
+			t.Errorf("LoadBTree(%d, %v, %v) = %v, want %v", c.degree, c.fill, c.keys, err, c.err)
+		}
+	}
+}
@@ -1,12 +1,19 @@
 package tree
 
-import "testing"
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/constraints"
+)
 
 // Tests lt of Key when the type is string.
 func TestStringKeyLt(t *testing.T) {
 	// GIVEN
-	k1 := Key[string]{"a", 1}
-	k2 := Key[string]{"b", 2}
+	k1 := Key[string, int32]{"a", 1}
+	k2 := Key[string, int32]{"b", 2}
 
 	// WHEN
 	lt := k1.lt(k2)
@@ -20,8 +27,8 @@ func TestStringKeyLt(t *testing.T) {
 // Tests lt of Key when the type is int.
 func TestIntKeyLt(t *testing.T) {
 	// GIVEN
-	k1 := Key[int]{1, 1}
-	k2 := Key[int]{2, 2}
+	k1 := Key[int, int32]{1, 1}
+	k2 := Key[int, int32]{2, 2}
 
 	// WHEN
 	lt := k1.lt(k2)
@@ -34,28 +41,27 @@ func TestIntKeyLt(t *testing.T) {
 
 func TestStringBtree(t *testing.T) {
 	// GIVEN
-	root := &BTNode[string]{
-		keys: []Key[string]{{"e", 0}, {"k", 30}},
-		children: []*BTNode[string]{
-			{keys: []Key[string]{{"a", 1}, {"b", 2}, {"v", 3}}, isLeaf: true, level: 2},
-			{keys: []Key[string]{{"fd", 4}, {"gd", 5}, {"h2", 6}}, isLeaf: true, level: 2},
-			{keys: []Key[string]{{"m1", 7}, {"m2", 8}, {"root", 9}}, isLeaf: true, level: 2}},
+	root := &BTNode[string, int32]{
+		keys: []Key[string, int32]{{"e", 0}, {"k", 30}},
+		children: []*BTNode[string, int32]{
+			{keys: []Key[string, int32]{{"a", 1}, {"b", 2}, {"v", 3}}, isLeaf: true},
+			{keys: []Key[string, int32]{{"fd", 4}, {"gd", 5}, {"h2", 6}}, isLeaf: true},
+			{keys: []Key[string, int32]{{"m1", 7}, {"m2", 8}, {"root", 9}}, isLeaf: true}},
 		isLeaf: false,
-		level:  1,
 	}
 	t.Log("traversing the tree before insertion")
 	traverse(root)
 
 	// WHEN
-	root.Insert(Key[string]{"food", 10})
-	root.Insert(Key[string]{"godd", 11})
-	root.Insert(Key[string]{"hi", 12})
-	root.Insert(Key[string]{"internet", 13})
-	root.Insert(Key[string]{"j", 14})
-	root.Insert(Key[string]{"kitty", 15})
-	root.Insert(Key[string]{"loop", 16})
-	root.Insert(Key[string]{"moon", 17})
-	root.Insert(Key[string]{"string", 18})
+	root.Insert(Key[string, int32]{"food", 10})
+	root.Insert(Key[string, int32]{"godd", 11})
+	root.Insert(Key[string, int32]{"hi", 12})
+	root.Insert(Key[string, int32]{"internet", 13})
+	root.Insert(Key[string, int32]{"j", 14})
+	root.Insert(Key[string, int32]{"kitty", 15})
+	root.Insert(Key[string, int32]{"loop", 16})
+	root.Insert(Key[string, int32]{"moon", 17})
+	root.Insert(Key[string, int32]{"string", 18})
 
 	// THEN
 	t.Log("traversing the tree after inserting food, godd, hi, internet, j, kitty, loop, moon, string")
@@ -67,28 +73,612 @@ func TestStringBtree(t *testing.T) {
 	if len(root.children) != 4 {
 		t.Errorf("root should have 4 children, but got %d", len(root.children))
 	}
-	if v := root.Search("food"); v != 10 {
+	if v, ok := root.Search("food"); !ok || v != 10 {
 		t.Error("food should be found")
 	}
-	if v := root.Search("kitty"); v != 15 {
+	if v, ok := root.Search("kitty"); !ok || v != 15 {
 		t.Error("kitty should be found")
 	}
-	if v := root.Search("internet"); v != 13 {
+	if v, ok := root.Search("internet"); !ok || v != 13 {
 		t.Error("internet should be found")
 	}
-	if v := root.Search("string"); v != 18 {
+	if v, ok := root.Search("string"); !ok || v != 18 {
 		t.Error("string should be found")
 	}
-	if v := root.Search("loop"); v != 16 {
+	if v, ok := root.Search("loop"); !ok || v != 16 {
 		t.Error("loop should be found")
 	}
-	if v := root.Search("hi"); v != 12 {
+	if v, ok := root.Search("hi"); !ok || v != 12 {
 		t.Error("hi should be found")
 	}
-	if v := root.Search("f"); v != -1 {
+	if _, ok := root.Search("f"); ok {
 		t.Error("f should not be found")
 	}
-	if v := root.Search("z"); v != -1 {
+	if _, ok := root.Search("z"); ok {
 		t.Error("z should not be found")
 	}
 }
+
+// fullBTNode returns a subtree of the given height, every node of which has
+// 2t-1 keys, the keys are 0, 2, 4, ... in order from next.
+func fullBTNode(t, height int, next *int) *BTNode[int, int] {
+	node := &BTNode[int, int]{isLeaf: height == 1}
+	for i := 0; i < 2*t-1; i++ {
+		if !node.isLeaf {
+			node.children = append(node.children, fullBTNode(t, height-1, next))
+		}
+		node.keys = append(node.keys, Key[int, int]{*next, *next})
+		*next += 2
+	}
+	if !node.isLeaf {
+		node.children = append(node.children, fullBTNode(t, height-1, next))
+	}
+	return node
+}
+
+func TestBTNodeSplitKeepsAllKeys(t *testing.T) {
+	// GIVEN
+	next := 0
+	left := fullBTNode(DefaultDegree, 2, &next)
+	middle := Key[int, int]{next, next}
+	next += 2
+	right := fullBTNode(DefaultDegree, 2, &next)
+	root := &BTNode[int, int]{keys: []Key[int, int]{middle}, children: []*BTNode[int, int]{left, right}}
+
+	// WHEN
+	// the full internal child is split first, then its halves and their
+	// leaves, and the left halves grow after splitting
+	for k := 1; k < middle.name; k += 2 {
+		root.Insert(Key[int, int]{k, k})
+	}
+
+	// THEN
+	for k := 0; k < next; k++ {
+		want := k%2 == 0 || k < middle.name
+		if v, ok := root.Search(k); ok != want || (ok && v != k) {
+			t.Fatalf("Search(%d) = %d, %v, want %v", k, v, ok, want)
+		}
+	}
+}
+
+// degrees are the minimum degrees which the B-tree tests run across.
+var degrees = []int{2, 3, 4, 7, 64}
+
+// checkBTree checks the B-tree invariants: every node except the root holds
+// t-1 to 2t-1 keys, an internal node has one more child than keys, keys are
+// in order, all leaves are at the same depth, and Len and Height match the
+// nodes.
+func checkBTree[K constraints.Ordered, V any](tree *BTree[K, V]) error {
+	if tree.root == nil {
+		if tree.size != 0 || tree.height != 0 {
+			return fmt.Errorf("empty tree has Len() = %d and Height() = %d", tree.size, tree.height)
+		}
+		return nil
+	}
+	t := tree.t
+	leafDepth := -1
+	count := 0
+	var prev *K
+	var check func(node *BTNode[K, V], depth int) error
+	check = func(node *BTNode[K, V], depth int) error {
+		n := len(node.keys)
+		if n > 2*t-1 {
+			return fmt.Errorf("node at depth %d has %d keys, more than %d", depth, n, 2*t-1)
+		}
+		if node != tree.root && n < t-1 {
+			return fmt.Errorf("node at depth %d has %d keys, less than %d", depth, n, t-1)
+		}
+		if node.isLeaf {
+			if len(node.children) != 0 {
+				return fmt.Errorf("leaf at depth %d has children", depth)
+			}
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if leafDepth != depth {
+				return fmt.Errorf("leaves at depth %d and %d", leafDepth, depth)
+			}
+		} else if len(node.children) != n+1 {
+			return fmt.Errorf("node at depth %d has %d keys and %d children", depth, n, len(node.children))
+		}
+		count += n
+		for i := 0; i <= n; i++ {
+			if !node.isLeaf {
+				if err := check(node.children[i], depth+1); err != nil {
+					return err
+				}
+			}
+			if i < n {
+				if prev != nil && *prev >= node.keys[i].name {
+					return fmt.Errorf("key %v breaks order", node.keys[i].name)
+				}
+				prev = &node.keys[i].name
+			}
+		}
+		return nil
+	}
+	if err := check(tree.root, 1); err != nil {
+		return err
+	}
+	if count != tree.size {
+		return fmt.Errorf("Len() = %d, want %d", tree.size, count)
+	}
+	if leafDepth != tree.height {
+		return fmt.Errorf("Height() = %d, want %d", tree.height, leafDepth)
+	}
+	return nil
+}
+
+func TestNewBTreeValidatesDegree(t *testing.T) {
+	if _, err := NewBTree[int, int](1); err != ErrInvalidDegree {
+		t.Errorf("NewBTree(1) = %v, want ErrInvalidDegree", err)
+	}
+	tree, err := NewBTree[int, int](100)
+	if err != nil || tree.Degree() != 100 {
+		t.Errorf("NewBTree(100) = %v, %v", tree, err)
+	}
+}
+
+func TestBTreeInsertAcrossDegrees(t *testing.T) {
+	for _, degree := range degrees {
+		// GIVEN
+		tree, _ := NewBTree[int, string](degree)
+		keys := rand.New(rand.NewSource(int64(degree))).Perm(2000)
+
+		// WHEN
+		for i, k := range keys {
+			tree.Put(k, fmt.Sprint(k))
+			if i%100 == 0 {
+				if err := checkBTree(tree); err != nil {
+					t.Fatalf("t = %d, after inserting %d keys: %v", degree, i+1, err)
+				}
+			}
+		}
+
+		// THEN
+		if err := checkBTree(tree); err != nil {
+			t.Fatalf("t = %d: %v", degree, err)
+		}
+		for _, k := range keys {
+			if v, ok := tree.Search(k); !ok || v != fmt.Sprint(k) {
+				t.Fatalf("t = %d, Search(%d) = %q, %v", degree, k, v, ok)
+			}
+		}
+		if _, ok := tree.Search(-1); ok {
+			t.Errorf("t = %d, Search(-1) should return false", degree)
+		}
+	}
+}
+
+func TestBTreeLenAndHeight(t *testing.T) {
+	// GIVEN
+	tree, _ := NewBTree[int, int](2)
+	if tree.Len() != 0 || tree.Height() != 0 {
+		t.Fatalf("empty tree: Len() = %d, Height() = %d, want 0, 0", tree.Len(), tree.Height())
+	}
+
+	// WHEN
+	heights := make([]int, 0, 16)
+	for k := 1; k <= 15; k++ {
+		tree.Put(k, k)
+		heights = append(heights, tree.Height())
+	}
+
+	// THEN
+	if tree.Len() != 15 {
+		t.Errorf("Len() = %d, want 15", tree.Len())
+	}
+	// a tree of degree 2 grows when inserting into a full root of 3 keys
+	want := []int{1, 1, 1, 2, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 3}
+	for i := range want {
+		if heights[i] != want[i] {
+			t.Fatalf("heights = %v, want %v", heights, want)
+		}
+	}
+	for k := 1; k <= 15; k++ {
+		tree.Delete(k)
+	}
+	if tree.Len() != 0 || tree.Height() != 0 {
+		t.Errorf("Len() = %d, Height() = %d, want 0, 0", tree.Len(), tree.Height())
+	}
+}
+
+// fullBTree returns a B-tree of the degree whose nodes are all full, it has
+// three levels for small degrees and two otherwise, and its keys are 0, 2, 4,
+// ... up to n.
+func fullBTree(degree int) (tree *BTree[int, int], n int) {
+	height := 3
+	if degree > 10 {
+		height = 2
+	}
+	tree, _ = NewBTree[int, int](degree)
+	tree.root = fullBTNode(degree, height, &n)
+	tree.size, tree.height = n/2, height
+	return tree, n
+}
+
+func TestBTreeDelete(t *testing.T) {
+	// GIVEN
+	tree, n := fullBTree(2)
+
+	// WHEN
+	deleted := tree.Delete(10)
+	notDeleted := tree.Delete(10)
+
+	// THEN
+	if !deleted || notDeleted {
+		t.Errorf("Delete(10) = %v, %v, want true, false", deleted, notDeleted)
+	}
+	if err := checkBTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree.Search(10); ok {
+		t.Error("Search(10) should return false")
+	}
+	for k := 0; k < n; k += 2 {
+		if k == 10 {
+			continue
+		}
+		if v, ok := tree.Search(k); !ok || v != k {
+			t.Errorf("Search(%d) = %d, %v, want %d, true", k, v, ok, k)
+		}
+	}
+}
+
+func TestBTreeDeleteShrinksRoot(t *testing.T) {
+	for _, degree := range degrees {
+		// GIVEN
+		tree, n := fullBTree(degree)
+
+		// WHEN
+		for k := 0; k < n; k += 2 {
+			if !tree.Delete(k) {
+				t.Fatalf("t = %d, Delete(%d) should return true", degree, k)
+			}
+			if err := checkBTree(tree); err != nil {
+				t.Fatalf("t = %d, after deleting %d: %v", degree, k, err)
+			}
+		}
+
+		// THEN
+		if tree.root != nil {
+			t.Errorf("t = %d, root should be nil", degree)
+		}
+		if tree.Delete(0) {
+			t.Errorf("t = %d, Delete(0) of empty tree should return false", degree)
+		}
+	}
+}
+
+func TestBTreeRandomInsertAndDelete(t *testing.T) {
+	for _, degree := range degrees {
+		// GIVEN
+		r := rand.New(rand.NewSource(int64(42 + degree)))
+		tree, n := fullBTree(degree)
+		model := make(map[int]int)
+		for k := 0; k < n; k += 2 {
+			model[k] = k
+		}
+
+		// WHEN
+		for i := 0; i < 20000; i++ {
+			k := r.Intn(n)
+			_, exist := model[k]
+			if r.Intn(2) == 0 {
+				if ok := tree.Delete(k); ok != exist {
+					t.Fatalf("t = %d, Delete(%d) = %v, want %v", degree, k, ok, exist)
+				}
+				delete(model, k)
+			} else {
+				tree.Put(k, i)
+				model[k] = i
+			}
+
+			// THEN
+			if err := checkBTree(tree); err != nil {
+				t.Fatalf("t = %d, after operation %d on key %d: %v", degree, i, k, err)
+			}
+		}
+		for k := 0; k < n; k++ {
+			v, ok := tree.Search(k)
+			if want, exist := model[k]; ok != exist || v != want {
+				t.Fatalf("t = %d, Search(%d) = %d, %v, want %d, %v", degree, k, v, ok, want, exist)
+			}
+		}
+	}
+}
+
+func TestBTreePutReplacesValue(t *testing.T) {
+	for _, degree := range degrees {
+		// GIVEN
+		tree, _ := NewBTree[int, int](degree)
+		for k := 0; k < 20*degree; k++ {
+			tree.Put(k, k)
+		}
+
+		// WHEN
+		for k := 0; k < 20*degree; k++ {
+			tree.Put(k, -1)
+		}
+
+		// THEN
+		if tree.Len() != 20*degree {
+			t.Errorf("t = %d, Len() = %d, want %d", degree, tree.Len(), 20*degree)
+		}
+		if err := checkBTree(tree); err != nil {
+			t.Fatalf("t = %d: %v", degree, err)
+		}
+		for k := 0; k < 20*degree; k++ {
+			if v, ok := tree.Get(k); !ok || v != -1 {
+				t.Fatalf("t = %d, Get(%d) = %d, %v, want -1, true", degree, k, v, ok)
+			}
+		}
+	}
+}
+
+func TestBTreeHas(t *testing.T) {
+	// GIVEN
+	tree, _ := NewBTree[string, struct{}](3)
+
+	// WHEN
+	tree.Put("a", struct{}{})
+	tree.Put("c", struct{}{})
+
+	// THEN
+	if !tree.Has("a") || !tree.Has("c") {
+		t.Error("Has() should return true for a and c")
+	}
+	if tree.Has("b") {
+		t.Error("Has(\"b\") should return false")
+	}
+}
+
+func TestBTNodeInsertReplacesValue(t *testing.T) {
+	// GIVEN
+	root := &BTNode[string, int32]{isLeaf: true}
+	for i, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		root.Insert(Key[string, int32]{k, int32(i)})
+	}
+
+	// WHEN
+	for _, k := range []string{"a", "d", "h"} {
+		root.Insert(Key[string, int32]{k, -1})
+	}
+
+	// THEN
+	n := 0
+	var count func(node *BTNode[string, int32])
+	count = func(node *BTNode[string, int32]) {
+		n += len(node.keys)
+		for _, c := range node.children {
+			count(c)
+		}
+	}
+	count(root)
+	if n != 8 {
+		t.Errorf("tree has %d keys, want 8", n)
+	}
+	for _, k := range []string{"a", "d", "h"} {
+		if v, ok := root.Search(k); !ok || v != -1 {
+			t.Errorf("Search(%q) = %d, %v, want -1, true", k, v, ok)
+		}
+	}
+}
+
+// btreeContents returns all keys and values of the B-tree by Ascend, and
+// checks they are in ascending order.
+func btreeContents(tree *BTree[int, int]) (map[int]int, error) {
+	m := make(map[int]int)
+	var last *int
+	var err error
+	tree.Ascend(func(k, v int) bool {
+		if last != nil && *last >= k {
+			err = fmt.Errorf("Ascend() visits %d after %d", k, *last)
+			return false
+		}
+		last = &k
+		m[k] = v
+		return true
+	})
+	return m, err
+}
+
+func TestBTreeAscend(t *testing.T) {
+	// GIVEN
+	tree, _ := NewBTree[int, int](2)
+	for _, k := range rand.New(rand.NewSource(7)).Perm(100) {
+		tree.Put(k, k*k)
+	}
+
+	// WHEN
+	var keys []int
+	tree.Ascend(func(k, v int) bool {
+		if v != k*k {
+			t.Errorf("Ascend() visits %d with %d, want %d", k, v, k*k)
+		}
+		keys = append(keys, k)
+		return k < 41
+	})
+
+	// THEN
+	if len(keys) != 42 {
+		t.Fatalf("Ascend() visits %d keys, want 42", len(keys))
+	}
+	for i, k := range keys {
+		if k != i {
+			t.Fatalf("Ascend() visits %d at %d", k, i)
+		}
+	}
+}
+
+func TestBTreeCloneIsIndependent(t *testing.T) {
+	for _, degree := range degrees {
+		// GIVEN
+		r := rand.New(rand.NewSource(int64(degree)))
+		tree, _ := NewBTree[int, int](degree)
+		model := make(map[int]int)
+		for i := 0; i < 2000; i++ {
+			k := r.Intn(1000)
+			tree.Put(k, i)
+			model[k] = i
+		}
+
+		// WHEN
+		clone := tree.Clone()
+		cloneModel := make(map[int]int, len(model))
+		for k, v := range model {
+			cloneModel[k] = v
+		}
+		for i := 0; i < 5000; i++ {
+			k := r.Intn(1000)
+			if r.Intn(2) == 0 {
+				tree.Delete(k)
+				delete(model, k)
+			} else {
+				tree.Put(k, -i)
+				model[k] = -i
+			}
+			k = r.Intn(1000)
+			if r.Intn(2) == 0 {
+				clone.Delete(k)
+				delete(cloneModel, k)
+			} else {
+				clone.Put(k, i)
+				cloneModel[k] = i
+			}
+		}
+
+		// THEN
+		for _, c := range []struct {
+			name  string
+			tree  *BTree[int, int]
+			model map[int]int
+		}{{"tree", tree, model}, {"clone", clone, cloneModel}} {
+			if err := checkBTree(c.tree); err != nil {
+				t.Fatalf("t = %d, %s: %v", degree, c.name, err)
+			}
+			got, err := btreeContents(c.tree)
+			if err != nil || !equalIntMaps(got, c.model) {
+				t.Fatalf("t = %d, %s has %d keys, want %d: %v", degree, c.name, len(got), len(c.model), err)
+			}
+		}
+	}
+}
+
+func equalIntMaps(a, b map[int]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBTreeCloneCopiesOnlyThePath(t *testing.T) {
+	// GIVEN
+	tree, _ := NewBTree[int, int](3)
+	for i := 0; i < 1000; i++ {
+		tree.Put(2*i, i)
+	}
+	snapshot := tree.Clone()
+
+	// WHEN
+	// the key is new, so the path goes down to a leaf
+	tree.Put(501, -1)
+
+	// THEN
+	old := make(map[*BTNode[int, int]]bool)
+	var walk func(node *BTNode[int, int], f func(*BTNode[int, int]))
+	walk = func(node *BTNode[int, int], f func(*BTNode[int, int])) {
+		f(node)
+		for _, child := range node.children {
+			walk(child, f)
+		}
+	}
+	walk(snapshot.root, func(node *BTNode[int, int]) { old[node] = true })
+	copied := 0
+	walk(tree.root, func(node *BTNode[int, int]) {
+		if !old[node] {
+			copied++
+		}
+	})
+	// the nodes from the root to the leaf of the key are copied, and a full
+	// node on the path is split into one more node
+	if copied < tree.Height() || copied > 2*tree.Height() {
+		t.Errorf("Put() after Clone() copies %d nodes, want the %d nodes on the path", copied, tree.Height())
+	}
+	if snapshot.Has(501) || snapshot.Len() != 1000 {
+		t.Errorf("snapshot should not see the new key")
+	}
+}
+
+func TestBTreeSnapshotIterationWhileWriting(t *testing.T) {
+	// GIVEN
+	tree, _ := NewBTree[int, int](4)
+	for i := 0; i < 5000; i++ {
+		tree.Put(i, i)
+	}
+	snapshot := tree.Clone()
+	done := make(chan error)
+
+	// WHEN
+	go func() {
+		for n := 0; n < 20; n++ {
+			got, err := btreeContents(snapshot)
+			if err == nil && len(got) != 5000 {
+				err = fmt.Errorf("snapshot has %d keys, want 5000", len(got))
+			}
+			for k, v := range got {
+				if err == nil && k != v {
+					err = fmt.Errorf("snapshot has %d at %d", v, k)
+				}
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		if k := r.Intn(10000); r.Intn(2) == 0 {
+			tree.Delete(k)
+		} else {
+			tree.Put(k, -k)
+		}
+	}
+
+	// THEN
+	// the race detector reports a write to a node shared with the snapshot
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if err := checkBTree(snapshot); err != nil || snapshot.Len() != 5000 {
+		t.Errorf("snapshot has %d keys: %v", snapshot.Len(), err)
+	}
+}
+
+// The B-tree maps the primary key of a row to the offset of the row in a data
+// file, so the row is read with one seek after the lookup.
+func ExampleBTree() {
+	index, _ := NewBTree[string, int64](DefaultDegree)
+	offset := int64(0)
+	for _, row := range []string{"alice,30", "bob,25", "carol,41"} {
+		name := row[:strings.IndexByte(row, ',')]
+		index.Put(name, offset)
+		offset += int64(len(row)) + 1
+	}
+
+	if offset, ok := index.Get("bob"); ok {
+		fmt.Println("bob is at offset", offset)
+	}
+	if !index.Has("dave") {
+		fmt.Println("dave is not found")
+	}
+	// Output:
+	// bob is at offset 9
+	// dave is not found
+}
@@ -0,0 +1,454 @@
+package tree
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/exp/constraints"
+)
+
+// LatchMode decides how writers of a ConcurrentBTree latch the nodes.
+type LatchMode int
+
+const (
+	// Pessimistic writers take write latches from the root down, and release
+	// the latches of the ancestors once they reach a node which can't split
+	// or merge.
+	Pessimistic LatchMode = iota
+	// Optimistic writers take read latches down to the leaf, and a write latch
+	// only on the leaf. If the leaf may split or merge, the writer releases it
+	// and retries pessimistically.
+	Optimistic
+)
+
+// cbNode is the node of ConcurrentBTree. Like bpNode, the values are only in
+// the leaves, and keys[i] of an internal node is the smallest key in the
+// subtree of children[i+1]. The latch protects keys, values and children,
+// isLeaf never changes after the node is created.
+type cbNode[K constraints.Ordered, V any] struct {
+	latch    sync.RWMutex
+	keys     []K
+	values   []V
+	children []*cbNode[K, V]
+	isLeaf   bool
+}
+
+// ConcurrentBTree is a B+ tree of minimum degree t which can be read and
+// written by many goroutines at the same time. Every node has at most 2t-1
+// keys, and every node but the root has at least t-1 keys.
+//
+// Every node has a read-write latch, and the latches are taken by crabbing
+// from the root down, so goroutines working on different subtrees don't block
+// each other. A reader latches the child before releasing the parent. A
+// writer holds the write latches of the ancestors which may be modified by a
+// split or a merge below them, and releases them as soon as it reaches a safe
+// node, which has room for one more key when inserting, or more than the
+// minimum keys when deleting. The root pointer has its own latch above the
+// root, which is held while the height may change.
+//
+// The values are only in the leaves, so an Optimistic writer only modifies the
+// leaf unless it splits or merges.
+type ConcurrentBTree[K constraints.Ordered, V any] struct {
+	// latch protects root and height.
+	latch  sync.RWMutex
+	root   *cbNode[K, V]
+	height int
+	t      int
+	mode   LatchMode
+	size   atomic.Int64
+}
+
+// NewConcurrentBTree returns an empty concurrent B+ tree of minimum degree t
+// whose writers latch nodes in the mode, it returns ErrInvalidDegree if t is
+// less than 2.
+func NewConcurrentBTree[K constraints.Ordered, V any](t int, mode LatchMode) (*ConcurrentBTree[K, V], error) {
+	if t < 2 {
+		return nil, ErrInvalidDegree
+	}
+	return &ConcurrentBTree[K, V]{root: &cbNode[K, V]{isLeaf: true}, height: 1, t: t, mode: mode}, nil
+}
+
+// Len returns the number of keys in the tree.
+func (tree *ConcurrentBTree[K, V]) Len() int {
+	return int(tree.size.Load())
+}
+
+// Height returns the number of levels of the tree, an empty tree has one empty
+// leaf.
+func (tree *ConcurrentBTree[K, V]) Height() int {
+	tree.latch.RLock()
+	defer tree.latch.RUnlock()
+	return tree.height
+}
+
+// Get returns the value of the key, the second result is false if the key is
+// not in the tree.
+func (tree *ConcurrentBTree[K, V]) Get(k K) (V, bool) {
+	tree.latch.RLock()
+	node := tree.root
+	node.latch.RLock()
+	tree.latch.RUnlock()
+	for !node.isLeaf {
+		child := node.children[node.childIndex(k)]
+		child.latch.RLock()
+		node.latch.RUnlock()
+		node = child
+	}
+	defer node.latch.RUnlock()
+	if i, found := node.index(k); found {
+		return node.values[i], true
+	}
+	var zero V
+	return zero, false
+}
+
+// Has reports whether the key is in the tree.
+func (tree *ConcurrentBTree[K, V]) Has(k K) bool {
+	_, ok := tree.Get(k)
+	return ok
+}
+
+// Put inserts the key with the value into the tree, if the key is already in
+// the tree, its value is replaced.
+func (tree *ConcurrentBTree[K, V]) Put(k K, v V) {
+	if tree.mode == Optimistic && tree.putOptimistic(k, v) {
+		return
+	}
+	tree.putPessimistic(k, v)
+}
+
+// Delete deletes the key from the tree and reports whether it was present.
+func (tree *ConcurrentBTree[K, V]) Delete(k K) bool {
+	if tree.mode == Optimistic {
+		if deleted, done := tree.deleteOptimistic(k); done {
+			return deleted
+		}
+	}
+	return tree.deletePessimistic(k)
+}
+
+// latchLeaf takes read latches from the root down, and returns the leaf of
+// the key with its write latch, all the other latches are released. The
+// second result reports whether the leaf is the root, which can't change
+// while the leaf is latched.
+func (tree *ConcurrentBTree[K, V]) latchLeaf(k K) (*cbNode[K, V], bool) {
+	tree.latch.RLock()
+	node := tree.root
+	if node.isLeaf {
+		node.latch.Lock()
+		tree.latch.RUnlock()
+		return node, true
+	}
+	node.latch.RLock()
+	tree.latch.RUnlock()
+	for {
+		child := node.children[node.childIndex(k)]
+		if child.isLeaf {
+			child.latch.Lock()
+			node.latch.RUnlock()
+			return child, false
+		}
+		child.latch.RLock()
+		node.latch.RUnlock()
+		node = child
+	}
+}
+
+// putOptimistic puts the key with only the leaf write latched, and reports
+// false without modifying the leaf if it's full and the key is new.
+func (tree *ConcurrentBTree[K, V]) putOptimistic(k K, v V) bool {
+	leaf, _ := tree.latchLeaf(k)
+	defer leaf.latch.Unlock()
+	i, found := leaf.index(k)
+	if found {
+		leaf.values[i] = v
+		return true
+	}
+	if len(leaf.keys) == 2*tree.t-1 {
+		return false
+	}
+	leaf.keys = insertAt(leaf.keys, i, k)
+	leaf.values = insertAt(leaf.values, i, v)
+	tree.size.Add(1)
+	return true
+}
+
+// deleteOptimistic deletes the key with only the leaf write latched. The
+// second result is false without modifying the leaf if it would drop below
+// the minimum keys.
+func (tree *ConcurrentBTree[K, V]) deleteOptimistic(k K) (bool, bool) {
+	leaf, root := tree.latchLeaf(k)
+	defer leaf.latch.Unlock()
+	i, found := leaf.index(k)
+	if !found {
+		return false, true
+	}
+	if !root && len(leaf.keys) == tree.t-1 {
+		return false, false
+	}
+	leaf.keys = removeAt(leaf.keys, i)
+	leaf.values = removeAt(leaf.values, i)
+	tree.size.Add(-1)
+	return true, true
+}
+
+// latchPath is the path of write latched nodes of a pessimistic writer, from
+// the topmost unsafe ancestor down. The latch of the tree is held if the root
+// is on the path.
+type latchPath[K constraints.Ordered, V any] struct {
+	tree  *ConcurrentBTree[K, V]
+	root  bool
+	nodes []*cbNode[K, V]
+	// index[i] is the index of nodes[i+1] in the children of nodes[i].
+	index []int
+}
+
+// push write latches the node, which is the i-th child of the last node on
+// the path.
+func (p *latchPath[K, V]) push(node *cbNode[K, V], i int) {
+	node.latch.Lock()
+	if len(p.nodes) > 0 {
+		p.index = append(p.index, i)
+	}
+	p.nodes = append(p.nodes, node)
+}
+
+// releaseAncestors releases the latches of all nodes on the path but the last
+// one, which is safe.
+func (p *latchPath[K, V]) releaseAncestors() {
+	if p.root {
+		p.tree.latch.Unlock()
+		p.root = false
+	}
+	last := len(p.nodes) - 1
+	for _, node := range p.nodes[:last] {
+		node.latch.Unlock()
+	}
+	p.nodes[0] = p.nodes[last]
+	p.nodes, p.index = truncate(p.nodes, 1), p.index[:0]
+}
+
+// release releases all latches on the path.
+func (p *latchPath[K, V]) release() {
+	if p.root {
+		p.tree.latch.Unlock()
+		p.root = false
+	}
+	for _, node := range p.nodes {
+		node.latch.Unlock()
+	}
+	p.nodes, p.index = p.nodes[:0], p.index[:0]
+}
+
+// descend write latches the path from the root to the leaf of the key by
+// crabbing, safe reports whether a latched node doesn't change its ancestors.
+func (tree *ConcurrentBTree[K, V]) descend(k K, safe func(node *cbNode[K, V], root bool) bool) *latchPath[K, V] {
+	tree.latch.Lock()
+	p := &latchPath[K, V]{tree: tree, root: true}
+	node := tree.root
+	p.push(node, 0)
+	if safe(node, true) {
+		p.releaseAncestors()
+	}
+	for !node.isLeaf {
+		i := node.childIndex(k)
+		node = node.children[i]
+		p.push(node, i)
+		if safe(node, false) {
+			p.releaseAncestors()
+		}
+	}
+	return p
+}
+
+// putPessimistic puts the key with the write latches of the unsafe ancestors
+// of the leaf, and splits the full nodes bottom-up.
+func (tree *ConcurrentBTree[K, V]) putPessimistic(k K, v V) {
+	p := tree.descend(k, func(node *cbNode[K, V], root bool) bool {
+		return len(node.keys) < 2*tree.t-1
+	})
+	defer p.release()
+	leaf := p.nodes[len(p.nodes)-1]
+	i, found := leaf.index(k)
+	if found {
+		leaf.values[i] = v
+		return
+	}
+	leaf.keys = insertAt(leaf.keys, i, k)
+	leaf.values = insertAt(leaf.values, i, v)
+	tree.size.Add(1)
+	for j := len(p.nodes) - 1; j >= 0 && len(p.nodes[j].keys) > 2*tree.t-1; j-- {
+		sep, right := p.nodes[j].split()
+		if j > 0 {
+			parent, i := p.nodes[j-1], p.index[j-1]
+			parent.keys = insertAt(parent.keys, i, sep)
+			parent.children = insertAt(parent.children, i+1, right)
+			continue
+		}
+		// only the root is split without a latched parent, and the latch of
+		// the tree is held since the root is unsafe
+		tree.root = &cbNode[K, V]{keys: []K{sep}, children: []*cbNode[K, V]{tree.root, right}}
+		tree.height++
+	}
+}
+
+// split moves the upper half of the node to a new node, and returns the
+// separator key and the new node, which isn't reachable by other goroutines
+// until it's added to the latched parent.
+func (node *cbNode[K, V]) split() (K, *cbNode[K, V]) {
+	m := len(node.keys) / 2
+	right := &cbNode[K, V]{isLeaf: node.isLeaf}
+	if node.isLeaf {
+		right.keys = append([]K(nil), node.keys[m:]...)
+		right.values = append([]V(nil), node.values[m:]...)
+		node.keys = truncate(node.keys, m)
+		node.values = truncate(node.values, m)
+		return right.keys[0], right
+	}
+	sep := node.keys[m]
+	right.keys = append([]K(nil), node.keys[m+1:]...)
+	right.children = append([]*cbNode[K, V](nil), node.children[m+1:]...)
+	node.keys = truncate(node.keys, m)
+	node.children = truncate(node.children, m+1)
+	return sep, right
+}
+
+// deletePessimistic deletes the key with the write latches of the unsafe
+// ancestors of the leaf, and fixes the nodes which drop below the minimum keys
+// bottom-up. The root leaf is always safe, and an internal root is unsafe with
+// one key, since it's replaced by its only child when it loses the key.
+func (tree *ConcurrentBTree[K, V]) deletePessimistic(k K) bool {
+	p := tree.descend(k, func(node *cbNode[K, V], root bool) bool {
+		if root {
+			return node.isLeaf || len(node.keys) > 1
+		}
+		return len(node.keys) > tree.t-1
+	})
+	defer p.release()
+	leaf := p.nodes[len(p.nodes)-1]
+	i, found := leaf.index(k)
+	if !found {
+		return false
+	}
+	leaf.keys = removeAt(leaf.keys, i)
+	leaf.values = removeAt(leaf.values, i)
+	tree.size.Add(-1)
+	for j := len(p.nodes) - 1; j > 0 && len(p.nodes[j].keys) < tree.t-1; j-- {
+		p.nodes[j-1].fix(p.index[j-1], tree.t)
+	}
+	if p.root && !tree.root.isLeaf && len(tree.root.keys) == 0 {
+		tree.root = tree.root.children[0]
+		tree.height--
+	}
+	return true
+}
+
+// fix fixes the i-th child which drops below t-1 keys by borrowing a key from
+// a sibling, or merging with it if the sibling has only t-1 keys. Both the
+// node and the child are write latched, and the sibling is latched here,
+// which can't deadlock since latches are only waited for from the top down.
+func (node *cbNode[K, V]) fix(i, t int) {
+	if i > 0 {
+		left := node.children[i-1]
+		left.latch.Lock()
+		defer left.latch.Unlock()
+		if len(left.keys) > t-1 {
+			node.borrowFromLeft(i)
+		} else {
+			node.merge(i - 1)
+		}
+		return
+	}
+	right := node.children[i+1]
+	right.latch.Lock()
+	defer right.latch.Unlock()
+	if len(right.keys) > t-1 {
+		node.borrowFromRight(i)
+	} else {
+		node.merge(i)
+	}
+}
+
+// borrowFromLeft moves the last key of the (i-1)-th child to the i-th child.
+func (node *cbNode[K, V]) borrowFromLeft(i int) {
+	child, left := node.children[i], node.children[i-1]
+	last := len(left.keys) - 1
+	if child.isLeaf {
+		child.keys = insertAt(child.keys, 0, left.keys[last])
+		child.values = insertAt(child.values, 0, left.values[last])
+		left.keys = truncate(left.keys, last)
+		left.values = truncate(left.values, last)
+		node.keys[i-1] = child.keys[0]
+		return
+	}
+	// the separator moves down, and the last key of the left child moves up
+	child.keys = insertAt(child.keys, 0, node.keys[i-1])
+	child.children = insertAt(child.children, 0, left.children[last+1])
+	node.keys[i-1] = left.keys[last]
+	left.keys = truncate(left.keys, last)
+	left.children = truncate(left.children, last+1)
+}
+
+// borrowFromRight moves the first key of the (i+1)-th child to the i-th child.
+func (node *cbNode[K, V]) borrowFromRight(i int) {
+	child, right := node.children[i], node.children[i+1]
+	if child.isLeaf {
+		child.keys = append(child.keys, right.keys[0])
+		child.values = append(child.values, right.values[0])
+		right.keys = removeAt(right.keys, 0)
+		right.values = removeAt(right.values, 0)
+		node.keys[i] = right.keys[0]
+		return
+	}
+	// the separator moves down, and the first key of the right child moves up
+	child.keys = append(child.keys, node.keys[i])
+	child.children = append(child.children, right.children[0])
+	node.keys[i] = right.keys[0]
+	right.keys = removeAt(right.keys, 0)
+	right.children = removeAt(right.children, 0)
+}
+
+// merge moves the keys of the (i+1)-th child into the i-th child, and removes
+// the (i+1)-th child with its separator from the node.
+func (node *cbNode[K, V]) merge(i int) {
+	left, right := node.children[i], node.children[i+1]
+	if left.isLeaf {
+		left.keys = append(left.keys, right.keys...)
+		left.values = append(left.values, right.values...)
+	} else {
+		left.keys = append(append(left.keys, node.keys[i]), right.keys...)
+		left.children = append(left.children, right.children...)
+	}
+	node.keys = removeAt(node.keys, i)
+	node.children = removeAt(node.children, i+1)
+}
+
+// index returns the index of the first key not less than k in the node, and
+// reports whether the key at the index equals k.
+func (node *cbNode[K, V]) index(k K) (int, bool) {
+	lo, hi := 0, len(node.keys)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if node.keys[mid] < k {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(node.keys) && node.keys[lo] == k
+}
+
+// childIndex returns the index of the child which the key belongs to, it's the
+// number of separator keys not greater than the key.
+func (node *cbNode[K, V]) childIndex(k K) int {
+	lo, hi := 0, len(node.keys)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if node.keys[mid] <= k {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
@@ -0,0 +1,243 @@
+package tree
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+var latchModes = []LatchMode{Pessimistic, Optimistic}
+
+// checkConcurrentBTree checks the invariants of the tree, no goroutine may
+// modify it meanwhile.
+func checkConcurrentBTree(tree *ConcurrentBTree[int, int]) error {
+	t := tree.t
+	leafDepth := 0
+	count := 0
+	var check func(node *cbNode[int, int], depth int, lo, hi *int) error
+	check = func(node *cbNode[int, int], depth int, lo, hi *int) error {
+		n := len(node.keys)
+		if n > 2*t-1 {
+			return fmt.Errorf("node at depth %d has %d keys, more than %d", depth, n, 2*t-1)
+		}
+		if node != tree.root && n < t-1 {
+			return fmt.Errorf("node at depth %d has %d keys, less than %d", depth, n, t-1)
+		}
+		for i, k := range node.keys {
+			if i > 0 && node.keys[i-1] >= k {
+				return fmt.Errorf("key %d breaks order at depth %d", k, depth)
+			}
+			if (lo != nil && k < *lo) || (hi != nil && k >= *hi) {
+				return fmt.Errorf("key %d is out of the separators at depth %d", k, depth)
+			}
+		}
+		if node.isLeaf {
+			if len(node.values) != n || len(node.children) != 0 {
+				return fmt.Errorf("leaf at depth %d has %d keys, %d values and %d children", depth, n, len(node.values), len(node.children))
+			}
+			if leafDepth == 0 {
+				leafDepth = depth
+			} else if leafDepth != depth {
+				return fmt.Errorf("leaves at depth %d and %d", leafDepth, depth)
+			}
+			count += n
+			return nil
+		}
+		if len(node.children) != n+1 || (node == tree.root && n == 0) {
+			return fmt.Errorf("node at depth %d has %d keys and %d children", depth, n, len(node.children))
+		}
+		for i, child := range node.children {
+			clo, chi := lo, hi
+			if i > 0 {
+				clo = &node.keys[i-1]
+			}
+			if i < n {
+				chi = &node.keys[i]
+			}
+			if err := check(child, depth+1, clo, chi); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(tree.root, 1, nil, nil); err != nil {
+		return err
+	}
+	if count != tree.Len() {
+		return fmt.Errorf("Len() = %d, want %d", tree.Len(), count)
+	}
+	if leafDepth != tree.Height() {
+		return fmt.Errorf("Height() = %d, want %d", tree.Height(), leafDepth)
+	}
+	return nil
+}
+
+func TestNewConcurrentBTreeValidatesDegree(t *testing.T) {
+	if _, err := NewConcurrentBTree[int, int](1, Pessimistic); err != ErrInvalidDegree {
+		t.Errorf("NewConcurrentBTree(1) = %v, want %v", err, ErrInvalidDegree)
+	}
+	tree, err := NewConcurrentBTree[int, int](2, Optimistic)
+	if err != nil || tree.Len() != 0 || tree.Height() != 1 {
+		t.Errorf("NewConcurrentBTree(2) = %v, Len() = %d, Height() = %d", err, tree.Len(), tree.Height())
+	}
+}
+
+func TestConcurrentBTreeRandomPutAndDelete(t *testing.T) {
+	for _, mode := range latchModes {
+		for _, degree := range []int{2, 3, 5} {
+			// GIVEN
+			r := rand.New(rand.NewSource(int64(degree)))
+			tree, _ := NewConcurrentBTree[int, int](degree, mode)
+			model := make(map[int]int)
+
+			// WHEN
+			for i := 0; i < 20000; i++ {
+				k := r.Intn(1000)
+				_, exist := model[k]
+				if r.Intn(2) == 0 {
+					if ok := tree.Delete(k); ok != exist {
+						t.Fatalf("mode %d, t = %d: Delete(%d) = %v, want %v", mode, degree, k, ok, exist)
+					}
+					delete(model, k)
+				} else {
+					tree.Put(k, i)
+					model[k] = i
+				}
+
+				// THEN
+				if err := checkConcurrentBTree(tree); err != nil {
+					t.Fatalf("mode %d, t = %d, after operation %d on key %d: %v", mode, degree, i, k, err)
+				}
+			}
+			for k := 0; k < 1000; k++ {
+				v, ok := tree.Get(k)
+				if want, exist := model[k]; ok != exist || v != want {
+					t.Fatalf("mode %d, t = %d: Get(%d) = %d, %v, want %d, %v", mode, degree, k, v, ok, want, exist)
+				}
+			}
+		}
+	}
+}
+
+func TestConcurrentBTreeStress(t *testing.T) {
+	const writers, readers, keys, ops = 8, 4, 4000, 5000
+	for _, mode := range latchModes {
+		for _, degree := range []int{2, 4} {
+			// GIVEN
+			tree, _ := NewConcurrentBTree[int, int](degree, mode)
+			// every writer owns the keys k with k%writers equal to its id, so it
+			// can check its reads against its own model
+			models := make([]map[int]int, writers)
+			errs := make(chan error, writers+readers)
+			var wg sync.WaitGroup
+
+			// WHEN
+			for w := 0; w < writers; w++ {
+				models[w] = make(map[int]int)
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					r := rand.New(rand.NewSource(int64(w)))
+					model := models[w]
+					for i := 0; i < ops; i++ {
+						k := r.Intn(keys/writers)*writers + w
+						switch r.Intn(3) {
+						case 0:
+							_, exist := model[k]
+							if ok := tree.Delete(k); ok != exist {
+								errs <- fmt.Errorf("Delete(%d) = %v, want %v", k, ok, exist)
+								return
+							}
+							delete(model, k)
+						case 1:
+							tree.Put(k, i)
+							model[k] = i
+						default:
+							v, ok := tree.Get(k)
+							if want, exist := model[k]; ok != exist || v != want {
+								errs <- fmt.Errorf("Get(%d) = %d, %v, want %d, %v", k, v, ok, want, exist)
+								return
+							}
+						}
+					}
+				}(w)
+			}
+			for g := 0; g < readers; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					r := rand.New(rand.NewSource(int64(100 + g)))
+					for i := 0; i < ops; i++ {
+						// the value of a key is always the index of an operation
+						if v, ok := tree.Get(r.Intn(keys)); ok && (v < 0 || v >= ops) {
+							errs <- fmt.Errorf("Get() = %d, which is never put", v)
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			close(errs)
+
+			// THEN
+			for err := range errs {
+				t.Fatalf("mode %d, t = %d: %v", mode, degree, err)
+			}
+			if err := checkConcurrentBTree(tree); err != nil {
+				t.Fatalf("mode %d, t = %d: %v", mode, degree, err)
+			}
+			total := 0
+			for w, model := range models {
+				total += len(model)
+				for k := w; k < keys; k += writers {
+					v, ok := tree.Get(k)
+					if want, exist := model[k]; ok != exist || v != want {
+						t.Fatalf("mode %d, t = %d: Get(%d) = %d, %v, want %d, %v", mode, degree, k, v, ok, want, exist)
+					}
+				}
+			}
+			if tree.Len() != total {
+				t.Errorf("mode %d, t = %d: Len() = %d, want %d", mode, degree, tree.Len(), total)
+			}
+		}
+	}
+}
+
+func TestConcurrentBTreeSharedKeys(t *testing.T) {
+	for _, mode := range latchModes {
+		// GIVEN
+		tree, _ := NewConcurrentBTree[int, int](3, mode)
+		var wg sync.WaitGroup
+
+		// WHEN
+		// all goroutines put and delete the same small set of keys, so the
+		// same leaves split and merge all the time
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				r := rand.New(rand.NewSource(int64(g)))
+				for i := 0; i < 5000; i++ {
+					k := r.Intn(300)
+					if r.Intn(2) == 0 {
+						tree.Delete(k)
+					} else {
+						tree.Put(k, k)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		// THEN
+		if err := checkConcurrentBTree(tree); err != nil {
+			t.Fatalf("mode %d: %v", mode, err)
+		}
+		for k := 0; k < 300; k++ {
+			if v, ok := tree.Get(k); ok && v != k {
+				t.Fatalf("mode %d: Get(%d) = %d", mode, k, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,696 @@
+package tree
+
+import (
+	"bytes"
+	"os"
+)
+
+// DefaultCacheSize is the number of pages cached by the buffer pool if it's not
+// set in the options.
+const DefaultCacheSize = 256
+
+// DiskOptions are the options of opening a disk B+ tree, the zero value uses
+// the defaults.
+type DiskOptions struct {
+	// PageSize is the page size of a new file, an existing file keeps the
+	// page size it was created with.
+	PageSize int
+	// CacheSize is the number of pages cached in memory.
+	CacheSize int
+	// WAL is the write-ahead log of OpenFile, the tree isn't crash-safe
+	// without it. Open always logs to the file at the path with "-wal".
+	WAL File
+	// Sync is the policy of syncing the log.
+	Sync SyncPolicy
+	// BatchSize is the number of commits between syncs of SyncBatch.
+	BatchSize int
+	// CheckpointSize is the size in bytes of the log which triggers a
+	// checkpoint.
+	CheckpointSize int64
+}
+
+// DiskBPlusTree is a B+ tree stored in fixed-size pages of a file, the keys and
+// the values are byte slices ordered by bytes.Compare. Page 0 holds the
+// header, and the other pages are leaves, internal nodes or free pages which
+// are reused before the file grows. Pages are cached by an LRU buffer pool,
+// modified pages are written to the file when they're evicted, and all of them
+// with the header by Sync.
+//
+// Unlike BPlusTree, a node is split when its encoded size exceeds the page
+// size rather than at a number of keys, and a node whose size drops below a
+// quarter of the page is merged with a sibling, or balanced with it if they
+// don't fit in one page.
+//
+// With a write-ahead log, every Put and Delete is committed to the log as one
+// operation, and the operations committed before a crash are redone when the
+// tree is opened again. After an I/O error the tree refuses all operations
+// and returns the error, it must be closed and opened again to recover.
+type DiskBPlusTree struct {
+	pager          *pager
+	pool           *bufferPool
+	wal            *wal
+	checkpointSize int64
+	err            error
+	// closed is the header when the tree was closed, so Len, Height and
+	// PageSize still work after Close.
+	closed diskMeta
+}
+
+// Open opens the disk B+ tree stored in the file at the path with the log at
+// the path with "-wal", both files are created if they don't exist.
+func Open(path string, opts *DiskOptions) (*DiskBPlusTree, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w, err := os.OpenFile(path+"-wal", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	o := DiskOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.WAL = w
+	tree, err := OpenFile(f, &o)
+	if err != nil {
+		f.Close()
+		w.Close()
+		return nil, err
+	}
+	return tree, nil
+}
+
+// OpenFile opens the disk B+ tree stored in the file, an empty file is
+// initialized as an empty tree. If the options have a log, the committed
+// operations in it are redone first. The tree owns the files and closes them
+// in Close.
+func OpenFile(f File, opts *DiskOptions) (*DiskBPlusTree, error) {
+	o := DiskOptions{PageSize: DefaultPageSize, CacheSize: DefaultCacheSize, BatchSize: DefaultBatchSize, CheckpointSize: DefaultCheckpointSize}
+	if opts != nil {
+		o.WAL, o.Sync = opts.WAL, opts.Sync
+		if opts.PageSize != 0 {
+			o.PageSize = opts.PageSize
+		}
+		if opts.CacheSize > 0 {
+			o.CacheSize = opts.CacheSize
+		}
+		if opts.BatchSize > 0 {
+			o.BatchSize = opts.BatchSize
+		}
+		if opts.CheckpointSize > 0 {
+			o.CheckpointSize = opts.CheckpointSize
+		}
+	}
+	p, err := openPager(f, o.PageSize)
+	var w *wal
+	if o.WAL != nil {
+		w = newWAL(o.WAL, o.Sync, o.BatchSize)
+		p, err = w.recover(f, p, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tree := &DiskBPlusTree{pager: p, pool: newBufferPool(p, o.CacheSize), wal: w, checkpointSize: o.CheckpointSize}
+	tree.pool.wal = w
+	return tree, nil
+}
+
+// check returns ErrClosed if the tree is closed, or the I/O error which the
+// tree failed with.
+func (tree *DiskBPlusTree) check() error {
+	if tree.pager == nil {
+		return ErrClosed
+	}
+	return tree.err
+}
+
+// finish commits the current operation to the log if it modified any page,
+// and keeps the error of the operation or the commit, so the tree refuses all
+// later operations.
+func (tree *DiskBPlusTree) finish(err error) error {
+	if err == nil && len(tree.pool.txn) > 0 {
+		err = tree.commit()
+	}
+	if err != nil {
+		tree.err = err
+	}
+	return err
+}
+
+// commit writes the images of the modified pages and the header to the log,
+// and checkpoints if the log is large enough.
+func (tree *DiskBPlusTree) commit() error {
+	tree.pool.logTxn()
+	err := tree.wal.commit(&tree.pager.meta)
+	tree.pool.endTxn()
+	if err != nil {
+		return err
+	}
+	if tree.wal.size >= tree.checkpointSize {
+		return tree.checkpoint()
+	}
+	return nil
+}
+
+// meta returns the header of the tree, or the one it had when it was closed.
+func (tree *DiskBPlusTree) meta() *diskMeta {
+	if tree.pager == nil {
+		return &tree.closed
+	}
+	return &tree.pager.meta
+}
+
+// Len returns the number of keys in the tree.
+func (tree *DiskBPlusTree) Len() int {
+	return int(tree.meta().count)
+}
+
+// Height returns the number of levels of the tree, which is 0 for an empty
+// tree and 1 for a tree with only one leaf.
+func (tree *DiskBPlusTree) Height() int {
+	return int(tree.meta().height)
+}
+
+// PageSize returns the page size of the file.
+func (tree *DiskBPlusTree) PageSize() int {
+	return int(tree.meta().pageSize)
+}
+
+// Get returns a copy of the value of the key, the second result is false if
+// the key is not in the tree.
+func (tree *DiskBPlusTree) Get(k []byte) ([]byte, bool, error) {
+	if err := tree.check(); err != nil {
+		return nil, false, err
+	}
+	leaf, err := tree.findLeaf(k)
+	if err != nil || leaf == nil {
+		return nil, false, err
+	}
+	defer tree.pool.unpin(leaf)
+	i, found := leaf.index(k)
+	if !found {
+		return nil, false, nil
+	}
+	return bytes.Clone(leaf.values[i]), true, nil
+}
+
+// Has reports whether the key is in the tree.
+func (tree *DiskBPlusTree) Has(k []byte) (bool, error) {
+	_, ok, err := tree.Get(k)
+	return ok, err
+}
+
+// findLeaf returns the pinned leaf which the key belongs to, or nil if the
+// tree is empty.
+func (tree *DiskBPlusTree) findLeaf(k []byte) (*diskNode, error) {
+	id := tree.pager.meta.root
+	if id == 0 {
+		return nil, nil
+	}
+	for {
+		node, err := tree.pool.fetch(id)
+		if err != nil {
+			return nil, err
+		}
+		if node.isLeaf() {
+			return node, nil
+		}
+		id = node.children[node.childIndex(k)]
+		tree.pool.unpin(node)
+	}
+}
+
+// maxEntrySize returns the maximum bytes of one key and value in a leaf, it's
+// a quarter of the page, so a split or a merge always fits in pages.
+func (tree *DiskBPlusTree) maxEntrySize() int {
+	return (tree.pager.pageSize - leafHeaderSize) / 4
+}
+
+// Put inserts the key with the value into the tree, if the key is already in
+// the tree, its value is replaced. Both are copied, and it returns ErrTooLarge
+// if they take more than a quarter of the page.
+func (tree *DiskBPlusTree) Put(k, v []byte) error {
+	if err := tree.check(); err != nil {
+		return err
+	}
+	if leafEntrySize(k, v) > tree.maxEntrySize() {
+		return ErrTooLarge
+	}
+	return tree.finish(tree.insert(k, v))
+}
+
+// insert inserts the key with the value into the tree, and adds a new root if
+// the root is split.
+func (tree *DiskBPlusTree) insert(k, v []byte) error {
+	m := &tree.pager.meta
+	if m.root == 0 {
+		leaf, err := tree.alloc(leafPage)
+		if err != nil {
+			return err
+		}
+		m.root, m.height = leaf.id, 1
+		tree.pool.unpin(leaf)
+	}
+	inserted, sep, right, err := tree.put(m.root, bytes.Clone(k), bytes.Clone(v))
+	if err != nil {
+		return err
+	}
+	if inserted {
+		m.count++
+	}
+	return tree.growRoot(sep, right)
+}
+
+// growRoot adds a new root above the old root and the new right node split
+// from it, it does nothing if right is 0.
+func (tree *DiskBPlusTree) growRoot(sep []byte, right uint32) error {
+	if right == 0 {
+		return nil
+	}
+	m := &tree.pager.meta
+	root, err := tree.alloc(internalPage)
+	if err != nil {
+		return err
+	}
+	root.keys = [][]byte{sep}
+	root.children = []uint32{m.root, right}
+	m.root = root.id
+	m.height++
+	tree.pool.unpin(root)
+	return nil
+}
+
+// put inserts the key with the value into the subtree of the page, and reports
+// whether the key is new. If the node is split, the separator key and the page
+// id of the new right node are returned for the parent.
+func (tree *DiskBPlusTree) put(id uint32, k, v []byte) (bool, []byte, uint32, error) {
+	node, err := tree.pool.fetch(id)
+	if err != nil {
+		return false, nil, 0, err
+	}
+	defer tree.pool.unpin(node)
+	inserted := true
+	if node.isLeaf() {
+		i, found := node.index(k)
+		if found {
+			// a larger value may overflow the leaf too
+			node.values[i] = v
+			inserted = false
+		} else {
+			node.keys = insertAt(node.keys, i, k)
+			node.values = insertAt(node.values, i, v)
+		}
+	} else {
+		i := node.childIndex(k)
+		var sep []byte
+		var right uint32
+		inserted, sep, right, err = tree.put(node.children[i], k, v)
+		if err != nil || right == 0 {
+			return inserted, nil, 0, err
+		}
+		node.keys = insertAt(node.keys, i, sep)
+		node.children = insertAt(node.children, i+1, right)
+	}
+	tree.pool.markDirty(node)
+	sep, right, err := tree.splitIfOverflow(node)
+	return inserted, sep, right, err
+}
+
+// splitIfOverflow splits the node if its encoded size exceeds the page size,
+// and returns the separator key and the page id of the new right node, or 0
+// if the node fits in one page.
+func (tree *DiskBPlusTree) splitIfOverflow(node *diskNode) ([]byte, uint32, error) {
+	if node.size() <= tree.pager.pageSize {
+		return nil, 0, nil
+	}
+	return tree.split(node)
+}
+
+// split moves the upper half of the node by bytes to a new node, and returns
+// the separator key and the page id of the new node. A new leaf is linked
+// after the node, and for an internal node the key between the two halves
+// moves up as the separator.
+func (tree *DiskBPlusTree) split(node *diskNode) ([]byte, uint32, error) {
+	right, err := tree.alloc(node.kind)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tree.pool.unpin(right)
+	if node.isLeaf() {
+		m := splitIndex(len(node.keys), 1, 1, func(i int) int {
+			return leafEntrySize(node.keys[i], node.values[i])
+		})
+		right.keys = append([][]byte(nil), node.keys[m:]...)
+		right.values = append([][]byte(nil), node.values[m:]...)
+		node.keys = truncate(node.keys, m)
+		node.values = truncate(node.values, m)
+		if err := tree.link(node, right, node.next); err != nil {
+			return nil, 0, err
+		}
+		return right.keys[0], right.id, nil
+	}
+	m := splitIndex(len(node.keys), 1, 2, func(i int) int {
+		return internalEntrySize(node.keys[i])
+	})
+	sep := node.keys[m]
+	right.keys = append([][]byte(nil), node.keys[m+1:]...)
+	right.children = append([]uint32(nil), node.children[m+1:]...)
+	node.keys = truncate(node.keys, m)
+	node.children = truncate(node.children, m+1)
+	return sep, right.id, nil
+}
+
+// link links the leaf between left and the page next, next is 0 if the leaf
+// is the last one.
+func (tree *DiskBPlusTree) link(left, leaf *diskNode, next uint32) error {
+	leaf.prev, leaf.next = left.id, next
+	left.next = leaf.id
+	tree.pool.markDirty(left)
+	tree.pool.markDirty(leaf)
+	return tree.setPrev(next, leaf.id)
+}
+
+// setPrev sets the previous leaf of the page, it does nothing if the page is
+// 0.
+func (tree *DiskBPlusTree) setPrev(id, prev uint32) error {
+	if id == 0 {
+		return nil
+	}
+	node, err := tree.pool.fetch(id)
+	if err != nil {
+		return err
+	}
+	node.prev = prev
+	tree.pool.markDirty(node)
+	tree.pool.unpin(node)
+	return nil
+}
+
+// Delete deletes the key from the tree and reports whether it was present.
+// When the root has only one child left, the child becomes the new root, and
+// the pages of deleted nodes are added to the free list. Balancing two nodes
+// changes the separator key in their parent, so a parent may overflow and be
+// split even when deleting.
+func (tree *DiskBPlusTree) Delete(k []byte) (bool, error) {
+	if err := tree.check(); err != nil {
+		return false, err
+	}
+	found, err := tree.remove(k)
+	return found, tree.finish(err)
+}
+
+// remove deletes the key from the tree, and replaces the root by its only
+// child or frees an empty root.
+func (tree *DiskBPlusTree) remove(k []byte) (bool, error) {
+	m := &tree.pager.meta
+	if m.root == 0 {
+		return false, nil
+	}
+	found, sep, right, err := tree.delete(m.root, k)
+	if err != nil || !found {
+		return false, err
+	}
+	m.count--
+	if err := tree.growRoot(sep, right); err != nil {
+		return true, err
+	}
+	root, err := tree.pool.fetch(m.root)
+	if err != nil {
+		return true, err
+	}
+	defer tree.pool.unpin(root)
+	if root.isLeaf() && len(root.keys) == 0 {
+		m.root, m.height = 0, 0
+		tree.free(root)
+	} else if !root.isLeaf() && len(root.children) == 1 {
+		m.root = root.children[0]
+		m.height--
+		tree.free(root)
+	}
+	return true, nil
+}
+
+// delete deletes the key from the subtree of the page, and reports whether the
+// key is found. A child which drops below a quarter of the page is fixed by
+// its parent after deleting. If the node is split, the separator key and the
+// page id of the new right node are returned for the parent.
+func (tree *DiskBPlusTree) delete(id uint32, k []byte) (bool, []byte, uint32, error) {
+	node, err := tree.pool.fetch(id)
+	if err != nil {
+		return false, nil, 0, err
+	}
+	defer tree.pool.unpin(node)
+	if node.isLeaf() {
+		i, found := node.index(k)
+		if !found {
+			return false, nil, 0, nil
+		}
+		node.keys = removeAt(node.keys, i)
+		node.values = removeAt(node.values, i)
+		tree.pool.markDirty(node)
+		return true, nil, 0, nil
+	}
+	i := node.childIndex(k)
+	found, sep, right, err := tree.delete(node.children[i], k)
+	if err != nil || !found {
+		return found, nil, 0, err
+	}
+	if right != 0 {
+		node.keys = insertAt(node.keys, i, sep)
+		node.children = insertAt(node.children, i+1, right)
+		tree.pool.markDirty(node)
+	} else if err := tree.fixUnderflow(node, i); err != nil {
+		return true, nil, 0, err
+	}
+	sep, right, err = tree.splitIfOverflow(node)
+	return true, sep, right, err
+}
+
+// fixUnderflow rebalances the i-th child of the node with a sibling if the
+// child drops below a quarter of the page.
+func (tree *DiskBPlusTree) fixUnderflow(node *diskNode, i int) error {
+	child, err := tree.pool.fetch(node.children[i])
+	if err != nil {
+		return err
+	}
+	underflow := child.size() < tree.pager.pageSize/4
+	tree.pool.unpin(child)
+	if !underflow {
+		return nil
+	}
+	if i == len(node.children)-1 {
+		i--
+	}
+	return tree.rebalance(node, i)
+}
+
+// rebalance merges the i-th and the (i+1)-th children of the parent if they
+// fit in one page, otherwise it moves keys between them so both halves have
+// about the same number of bytes.
+func (tree *DiskBPlusTree) rebalance(parent *diskNode, i int) error {
+	left, err := tree.pool.fetch(parent.children[i])
+	if err != nil {
+		return err
+	}
+	defer tree.pool.unpin(left)
+	right, err := tree.pool.fetch(parent.children[i+1])
+	if err != nil {
+		return err
+	}
+	defer tree.pool.unpin(right)
+	tree.pool.markDirty(parent)
+	tree.pool.markDirty(left)
+	tree.pool.markDirty(right)
+
+	if left.isLeaf() {
+		keys := append(append(make([][]byte, 0, len(left.keys)+len(right.keys)), left.keys...), right.keys...)
+		values := append(append(make([][]byte, 0, len(keys)), left.values...), right.values...)
+		if left.size()+right.size()-leafHeaderSize <= tree.pager.pageSize {
+			left.keys, left.values = keys, values
+			left.next = right.next
+			if err := tree.setPrev(right.next, left.id); err != nil {
+				return err
+			}
+			parent.keys = removeAt(parent.keys, i)
+			parent.children = removeAt(parent.children, i+1)
+			tree.free(right)
+			return nil
+		}
+		m := splitIndex(len(keys), 1, 1, func(j int) int {
+			return leafEntrySize(keys[j], values[j])
+		})
+		left.keys, right.keys = keys[:m:m], append([][]byte(nil), keys[m:]...)
+		left.values, right.values = values[:m:m], append([][]byte(nil), values[m:]...)
+		parent.keys[i] = right.keys[0]
+		return nil
+	}
+
+	// the separator key moves down between the keys of the two children
+	keys := make([][]byte, 0, len(left.keys)+len(right.keys)+1)
+	keys = append(append(append(keys, left.keys...), parent.keys[i]), right.keys...)
+	children := append(append(make([]uint32, 0, len(keys)+1), left.children...), right.children...)
+	if left.size()+internalEntrySize(parent.keys[i])+right.size()-internalHeaderSize <= tree.pager.pageSize {
+		left.keys, left.children = keys, children
+		parent.keys = removeAt(parent.keys, i)
+		parent.children = removeAt(parent.children, i+1)
+		tree.free(right)
+		return nil
+	}
+	m := splitIndex(len(keys), 1, 2, func(j int) int {
+		return internalEntrySize(keys[j])
+	})
+	parent.keys[i] = keys[m]
+	left.keys, right.keys = keys[:m:m], append([][]byte(nil), keys[m+1:]...)
+	left.children, right.children = children[:m+1:m+1], append([]uint32(nil), children[m+1:]...)
+	return nil
+}
+
+// alloc returns a pinned empty node of the kind, its page is taken from the
+// free list, or appended to the end of the file if the free list is empty.
+func (tree *DiskBPlusTree) alloc(kind byte) (*diskNode, error) {
+	m := &tree.pager.meta
+	if m.freeHead == 0 {
+		id := m.pageCount
+		m.pageCount++
+		return tree.pool.create(id, kind)
+	}
+	node, err := tree.pool.fetch(m.freeHead)
+	if err != nil {
+		return nil, err
+	}
+	m.freeHead = node.next
+	node.reset(kind)
+	tree.pool.markDirty(node)
+	return node, nil
+}
+
+// free adds the page of the pinned node to the front of the free list.
+func (tree *DiskBPlusTree) free(node *diskNode) {
+	m := &tree.pager.meta
+	node.reset(freePage)
+	node.next = m.freeHead
+	m.freeHead = node.id
+	tree.pool.markDirty(node)
+}
+
+// Ascend calls f for every key and value in ascending order until f returns
+// false. The key and the value are only valid until f returns, and the tree
+// must not be modified by f.
+func (tree *DiskBPlusTree) Ascend(f func(k, v []byte) bool) error {
+	return tree.Range(nil, nil, f)
+}
+
+// Range calls f for every key in [lo, hi) and its value in ascending order
+// until f returns false, a nil hi means no upper bound. It seeks lo once, then
+// scans along the linked leaves.
+func (tree *DiskBPlusTree) Range(lo, hi []byte, f func(k, v []byte) bool) error {
+	if err := tree.check(); err != nil {
+		return err
+	}
+	leaf, err := tree.findLeaf(lo)
+	if err != nil || leaf == nil {
+		return err
+	}
+	i, _ := leaf.index(lo)
+	for {
+		for ; i < len(leaf.keys); i++ {
+			if hi != nil && bytes.Compare(leaf.keys[i], hi) >= 0 {
+				tree.pool.unpin(leaf)
+				return nil
+			}
+			if !f(leaf.keys[i], leaf.values[i]) {
+				tree.pool.unpin(leaf)
+				return nil
+			}
+		}
+		next := leaf.next
+		tree.pool.unpin(leaf)
+		if next == 0 {
+			return nil
+		}
+		if leaf, err = tree.pool.fetch(next); err != nil {
+			return err
+		}
+		i = 0
+	}
+}
+
+// Sync commits the tree to stable storage. With a log, it syncs the log, so
+// the operations are durable whatever the policy is; without a log, it writes
+// all modified pages and the header to the file and syncs the file.
+func (tree *DiskBPlusTree) Sync() error {
+	if err := tree.check(); err != nil {
+		return err
+	}
+	if tree.wal != nil {
+		return tree.finish(tree.wal.sync())
+	}
+	return tree.finish(tree.flush())
+}
+
+// Checkpoint writes all modified pages and the header to the file and syncs
+// it, then truncates the log, so opening the tree doesn't need to redo
+// anything. It's called when the log grows beyond DiskOptions.CheckpointSize.
+func (tree *DiskBPlusTree) Checkpoint() error {
+	if err := tree.check(); err != nil {
+		return err
+	}
+	return tree.finish(tree.checkpoint())
+}
+
+// checkpoint syncs the log before writing pages, and truncates the log after
+// the file is synced. A crash at any point leaves either the log or the file
+// with all committed operations. Nothing is written if the log is empty, so
+// the header isn't rewritten without a log to recover it from.
+func (tree *DiskBPlusTree) checkpoint() error {
+	if tree.wal == nil {
+		return tree.flush()
+	}
+	if tree.wal.size == 0 {
+		return nil
+	}
+	if err := tree.wal.sync(); err != nil {
+		return err
+	}
+	if err := tree.flush(); err != nil {
+		return err
+	}
+	return tree.wal.reset()
+}
+
+// flush writes all modified pages and the header to the file and syncs it.
+func (tree *DiskBPlusTree) flush() error {
+	if err := tree.pool.flush(); err != nil {
+		return err
+	}
+	if err := tree.pager.writeHeader(); err != nil {
+		return err
+	}
+	return tree.pager.file.Sync()
+}
+
+// Close checkpoints the tree and closes the files, the tree can't be used
+// after Close. If the tree failed with an I/O error, nothing is written and
+// the committed operations are redone by the next Open.
+func (tree *DiskBPlusTree) Close() error {
+	if tree.pager == nil {
+		return ErrClosed
+	}
+	err := tree.err
+	if err == nil {
+		err = tree.checkpoint()
+	}
+	if cerr := tree.pager.file.Close(); err == nil {
+		err = cerr
+	}
+	if tree.wal != nil {
+		if cerr := tree.wal.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	tree.closed = tree.pager.meta
+	tree.pager, tree.pool, tree.wal = nil, nil, nil
+	return err
+}
@@ -0,0 +1,456 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// memFile is an in-memory File for tests.
+type memFile struct {
+	data   []byte
+	syncs  int
+	closed bool
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(f.data) {
+		f.data = append(f.data, make([]byte, end-len(f.data))...)
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func (f *memFile) Sync() error {
+	f.syncs++
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	if int(size) <= len(f.data) {
+		f.data = f.data[:size]
+	} else {
+		f.data = append(f.data, make([]byte, int(size)-len(f.data))...)
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+// diskKey returns the key of the integer, keys of integers are in the same
+// order as the integers.
+func diskKey(i int) []byte {
+	return []byte(fmt.Sprintf("key-%06d", i))
+}
+
+// checkDiskBPlusTree checks the invariants of the disk B+ tree: every node fits
+// in one page, keys are in order and bounded by the separators, all leaves are
+// at the same depth and linked in order, and Len and Height match the nodes.
+// It also checks that every page is either in the tree or in the free list.
+func checkDiskBPlusTree(tree *DiskBPlusTree) error {
+	m := tree.pager.meta
+	used := map[uint32]bool{}
+	leafDepth := 0
+	count := 0
+	var leaves []uint32
+	var check func(id uint32, depth int, lo, hi []byte) error
+	check = func(id uint32, depth int, lo, hi []byte) error {
+		if used[id] {
+			return fmt.Errorf("page %d is used twice", id)
+		}
+		used[id] = true
+		node, err := tree.pool.fetch(id)
+		if err != nil {
+			return err
+		}
+		defer tree.pool.unpin(node)
+		if node.size() > tree.pager.pageSize {
+			return fmt.Errorf("page %d has %d bytes", id, node.size())
+		}
+		for i, k := range node.keys {
+			if i > 0 && bytes.Compare(node.keys[i-1], k) >= 0 {
+				return fmt.Errorf("key %q breaks order in page %d", k, id)
+			}
+			if (lo != nil && bytes.Compare(k, lo) < 0) || (hi != nil && bytes.Compare(k, hi) >= 0) {
+				return fmt.Errorf("key %q is out of the separators in page %d", k, id)
+			}
+		}
+		switch node.kind {
+		case leafPage:
+			if id != m.root && len(node.keys) == 0 {
+				return fmt.Errorf("leaf %d is empty", id)
+			}
+			if leafDepth == 0 {
+				leafDepth = depth
+			} else if leafDepth != depth {
+				return fmt.Errorf("leaves at depth %d and %d", leafDepth, depth)
+			}
+			count += len(node.keys)
+			leaves = append(leaves, id)
+			return nil
+		case internalPage:
+			if len(node.children) != len(node.keys)+1 || len(node.children) < 2 {
+				return fmt.Errorf("page %d has %d keys and %d children", id, len(node.keys), len(node.children))
+			}
+			for i, child := range node.children {
+				clo, chi := lo, hi
+				if i > 0 {
+					clo = node.keys[i-1]
+				}
+				if i < len(node.keys) {
+					chi = node.keys[i]
+				}
+				if err := check(child, depth+1, clo, chi); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return fmt.Errorf("page %d of kind %d is in the tree", id, node.kind)
+	}
+	if m.root != 0 {
+		if err := check(m.root, 1, nil, nil); err != nil {
+			return err
+		}
+	}
+	for i, id := range leaves {
+		node, err := tree.pool.fetch(id)
+		if err != nil {
+			return err
+		}
+		var prev, next uint32
+		if i > 0 {
+			prev = leaves[i-1]
+		}
+		if i < len(leaves)-1 {
+			next = leaves[i+1]
+		}
+		if node.prev != prev || node.next != next {
+			tree.pool.unpin(node)
+			return fmt.Errorf("leaf %d is not linked to its neighbours", id)
+		}
+		tree.pool.unpin(node)
+	}
+	for id := m.freeHead; id != 0; {
+		if used[id] {
+			return fmt.Errorf("free page %d is used", id)
+		}
+		used[id] = true
+		node, err := tree.pool.fetch(id)
+		if err != nil {
+			return err
+		}
+		if node.kind != freePage {
+			tree.pool.unpin(node)
+			return fmt.Errorf("page %d in the free list has kind %d", id, node.kind)
+		}
+		id = node.next
+		tree.pool.unpin(node)
+	}
+	if len(used) != int(m.pageCount)-1 {
+		return fmt.Errorf("%d pages are reachable, want %d", len(used), m.pageCount-1)
+	}
+	if count != tree.Len() {
+		return fmt.Errorf("Len() = %d, want %d", tree.Len(), count)
+	}
+	if leafDepth != tree.Height() {
+		return fmt.Errorf("Height() = %d, want %d", tree.Height(), leafDepth)
+	}
+	for id, node := range tree.pool.nodes {
+		if node.pins != 0 {
+			return fmt.Errorf("page %d is still pinned", id)
+		}
+	}
+	return nil
+}
+
+func TestDiskNodeEncoding(t *testing.T) {
+	cases := []*diskNode{
+		{kind: leafPage, keys: [][]byte{[]byte("a"), []byte("bc")}, values: [][]byte{[]byte(""), []byte("value")}, prev: 3, next: 9},
+		{kind: internalPage, keys: [][]byte{[]byte("m"), []byte("t")}, children: []uint32{4, 5, 6}},
+		{kind: freePage, next: 12},
+	}
+	for _, want := range cases {
+		// GIVEN
+		page := bytes.Repeat([]byte{0xff}, 256)
+
+		// WHEN
+		want.encode(page)
+		got, err := decodeNode(7, page)
+
+		// THEN
+		if err != nil {
+			t.Fatalf("decodeNode() = %v", err)
+		}
+		if got.id != 7 || got.kind != want.kind || got.prev != want.prev || got.next != want.next ||
+			fmt.Sprint(got.keys, got.values, got.children) != fmt.Sprint(want.keys, want.values, want.children) {
+			t.Errorf("decodeNode() = %+v, want %+v", got, want)
+		}
+		if got.size() != want.size() {
+			t.Errorf("size() = %d, want %d", got.size(), want.size())
+		}
+	}
+	if _, err := decodeNode(1, make([]byte, 256)); err != ErrCorrupt {
+		t.Errorf("decodeNode() of zero page = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestBufferPoolEvictsLeastRecentlyUsed(t *testing.T) {
+	// GIVEN
+	p, _ := openPager(&memFile{}, 256)
+	pool := newBufferPool(p, 2)
+	p.meta.pageCount = 4
+	var nodes []*diskNode
+	for id := uint32(1); id <= 3; id++ {
+		node, _ := pool.create(id, leafPage)
+		node.keys, node.values = [][]byte{diskKey(int(id))}, [][]byte{nil}
+		nodes = append(nodes, node)
+	}
+
+	// WHEN
+	// all three are pinned, so the pool grows beyond its capacity
+	n := len(pool.nodes)
+	pool.unpin(nodes[0])
+	pool.unpin(nodes[2])
+	pool.unpin(nodes[1])
+	node, err := pool.create(4, leafPage)
+
+	// THEN
+	if err != nil || n != 3 {
+		t.Fatalf("create() = %v, len(nodes) = %d, want 3 pinned nodes", err, n)
+	}
+	// pages 1 and 3 are the least recently used ones, they're evicted to make
+	// room for page 4
+	if _, ok := pool.nodes[1]; ok {
+		t.Error("page 1 should be evicted")
+	}
+	if _, ok := pool.nodes[3]; ok {
+		t.Error("page 3 should be evicted")
+	}
+	if _, ok := pool.nodes[2]; !ok {
+		t.Error("page 2 is the most recently used and should be cached")
+	}
+	pool.unpin(node)
+	p.meta.pageCount = 5
+	node, err = pool.fetch(1)
+	if err != nil || string(node.keys[0]) != string(diskKey(1)) || node.dirty {
+		t.Errorf("fetch(1) = %v, %v, want the written back clean page", node, err)
+	}
+}
+
+func TestDiskBPlusTreeRandomPutAndDelete(t *testing.T) {
+	for _, pageSize := range []int{256, 1024} {
+		// GIVEN
+		r := rand.New(rand.NewSource(int64(pageSize)))
+		tree, err := OpenFile(&memFile{}, &DiskOptions{PageSize: pageSize, CacheSize: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		model := make(map[string]string)
+
+		// WHEN
+		for i := 0; i < 5000; i++ {
+			k := diskKey(r.Intn(600))
+			if r.Intn(2) == 0 {
+				_, exist := model[string(k)]
+				if ok, err := tree.Delete(k); err != nil || ok != exist {
+					t.Fatalf("page size %d, Delete(%s) = %v, %v, want %v", pageSize, k, ok, err, exist)
+				}
+				delete(model, string(k))
+			} else {
+				v := bytes.Repeat([]byte{byte(i)}, r.Intn(20))
+				if err := tree.Put(k, v); err != nil {
+					t.Fatal(err)
+				}
+				model[string(k)] = string(v)
+			}
+
+			// THEN
+			if i%50 == 0 {
+				if err := checkDiskBPlusTree(tree); err != nil {
+					t.Fatalf("page size %d, after operation %d: %v", pageSize, i, err)
+				}
+			}
+		}
+		if err := checkDiskBPlusTree(tree); err != nil {
+			t.Fatalf("page size %d: %v", pageSize, err)
+		}
+		for i := 0; i < 600; i++ {
+			v, ok, err := tree.Get(diskKey(i))
+			want, exist := model[string(diskKey(i))]
+			if err != nil || ok != exist || string(v) != want {
+				t.Fatalf("page size %d, Get(%d) = %q, %v, %v, want %q, %v", pageSize, i, v, ok, err, want, exist)
+			}
+		}
+	}
+}
+
+func TestDiskBPlusTreeReopen(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "index.db")
+	tree, err := Open(path, &DiskOptions{PageSize: 512, CacheSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := tree.Put(diskKey(i), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 1000; i += 3 {
+		if _, err := tree.Delete(diskKey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	height := tree.Height()
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// WHEN
+	tree, err = Open(path, nil)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if tree.PageSize() != 512 || tree.Height() != height || tree.Len() != 666 {
+		t.Errorf("PageSize() = %d, Height() = %d, Len() = %d, want 512, %d, 666", tree.PageSize(), tree.Height(), tree.Len(), height)
+	}
+	if err := checkDiskBPlusTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		v, ok, err := tree.Get(diskKey(i))
+		if err != nil || ok != (i%3 != 0) || (ok && string(v) != fmt.Sprint(i)) {
+			t.Fatalf("Get(%d) = %q, %v, %v", i, v, ok, err)
+		}
+	}
+}
+
+func TestDiskBPlusTreeReusesFreePages(t *testing.T) {
+	// GIVEN
+	tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 256})
+	for i := 0; i < 500; i++ {
+		tree.Put(diskKey(i), diskKey(i))
+	}
+	pages := tree.pager.meta.pageCount
+
+	// WHEN
+	for i := 0; i < 500; i++ {
+		tree.Delete(diskKey(i))
+	}
+	for i := 0; i < 500; i++ {
+		tree.Put(diskKey(i), diskKey(i))
+	}
+
+	// THEN
+	if tree.pager.meta.pageCount != pages {
+		t.Errorf("file grows from %d to %d pages, free pages should be reused", pages, tree.pager.meta.pageCount)
+	}
+	if err := checkDiskBPlusTree(tree); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskBPlusTreeRange(t *testing.T) {
+	// GIVEN
+	tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 256, CacheSize: 4})
+	for _, i := range rand.New(rand.NewSource(1)).Perm(300) {
+		tree.Put(diskKey(i), nil)
+	}
+
+	// WHEN
+	var keys []string
+	err := tree.Range(diskKey(100), diskKey(200), func(k, v []byte) bool {
+		keys = append(keys, string(k))
+		return true
+	})
+	var all []string
+	tree.Ascend(func(k, v []byte) bool {
+		all = append(all, string(k))
+		return true
+	})
+
+	// THEN
+	if err != nil || len(keys) != 100 || keys[0] != string(diskKey(100)) || !sort.StringsAreSorted(keys) {
+		t.Errorf("Range() = %v, %v, want keys from 100 to 199", keys, err)
+	}
+	if len(all) != 300 || !sort.StringsAreSorted(all) {
+		t.Errorf("Ascend() returns %d keys, want 300 sorted keys", len(all))
+	}
+}
+
+func TestDiskBPlusTreeRejectsLargeEntry(t *testing.T) {
+	tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 256})
+	if err := tree.Put(make([]byte, 100), nil); err != ErrTooLarge {
+		t.Errorf("Put() = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestOpenFileValidatesHeader(t *testing.T) {
+	if _, err := OpenFile(&memFile{}, &DiskOptions{PageSize: 1000}); err != ErrInvalidPageSize {
+		t.Errorf("OpenFile() = %v, want ErrInvalidPageSize", err)
+	}
+	f := &memFile{}
+	tree, _ := OpenFile(f, nil)
+	tree.Put([]byte("k"), []byte("v"))
+	tree.Close()
+	f.data[20] ^= 1
+	if _, err := OpenFile(f, nil); err != ErrCorrupt {
+		t.Errorf("OpenFile() of modified header = %v, want ErrCorrupt", err)
+	}
+	if _, err := OpenFile(&memFile{data: []byte("short")}, nil); err != ErrCorrupt {
+		t.Errorf("OpenFile() of short file = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestDiskBPlusTreeClose(t *testing.T) {
+	f := &memFile{}
+	tree, _ := OpenFile(f, nil)
+	if err := tree.Close(); err != nil || !f.closed || f.syncs == 0 {
+		t.Errorf("Close() = %v, the file should be synced and closed", err)
+	}
+	if err := tree.Put([]byte("k"), nil); err != ErrClosed {
+		t.Errorf("Put() after Close() = %v, want ErrClosed", err)
+	}
+}
+
+func TestDiskBPlusTreeStatsAfterClose(t *testing.T) {
+	// GIVEN
+	tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 512})
+	for i := 0; i < 100; i++ {
+		if err := tree.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	height := tree.Height()
+
+	// WHEN
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// THEN
+	if tree.Len() != 100 || tree.Height() != height || tree.PageSize() != 512 {
+		t.Errorf("Len() = %d, Height() = %d, PageSize() = %d after Close(), want 100, %d, 512", tree.Len(), tree.Height(), tree.PageSize(), height)
+	}
+}
@@ -0,0 +1,282 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrNotEmpty is returned when bulk loading a disk B+ tree which has keys.
+var ErrNotEmpty = errors.New("tree: bulk loading needs an empty tree")
+
+// Load loads the keys sorted in strictly ascending order into the empty tree,
+// values[i] is the value of keys[i]. It panics if the lengths of keys and
+// values differ. See LoadFunc for the fill factor.
+func (tree *DiskBPlusTree) Load(fill float64, keys, values [][]byte) error {
+	if len(keys) != len(values) {
+		panic("tree: Load with different numbers of keys and values")
+	}
+	i := 0
+	return tree.LoadFunc(fill, func() ([]byte, []byte, bool) {
+		if i == len(keys) {
+			return nil, nil, false
+		}
+		i++
+		return keys[i-1], values[i-1], true
+	})
+}
+
+// LoadFunc loads the keys and values returned by next until it returns false
+// into the empty tree, the keys must be in strictly ascending order. Like
+// LoadBTreeFunc, the pages are built bottom-up, and only the last two nodes
+// of every level are kept in memory, so the input may be larger than the
+// memory. Both are copied, so next may reuse its buffers.
+//
+// Every page is filled to fill times the page size in bytes, except those on
+// the right edge, and a fill factor below one half is rounded up to it. The
+// new pages are written after the end of the file bypassing the buffer pool
+// and the log, and the tree only sees them when the header is committed at
+// the end, so a crash or an error in the middle leaves the tree empty. It
+// returns ErrNotEmpty, ErrInvalidFillFactor, ErrTooLarge, or ErrUnsorted if a
+// key is not greater than the one before it.
+func (tree *DiskBPlusTree) LoadFunc(fill float64, next func() (k, v []byte, ok bool)) error {
+	if err := tree.check(); err != nil {
+		return err
+	}
+	if tree.pager.meta.root != 0 {
+		return ErrNotEmpty
+	}
+	if !(fill > 0 && fill <= 1) {
+		return ErrInvalidFillFactor
+	}
+	target := int(fill * float64(tree.pager.pageSize))
+	if target < tree.pager.pageSize/2 {
+		target = tree.pager.pageSize / 2
+	}
+	l := &diskLoader{tree: tree, target: target, id: tree.pager.meta.pageCount, page: make([]byte, tree.pager.pageSize)}
+	l.levels = []*diskLevel{{cur: &diskNode{kind: leafPage}}}
+	for {
+		k, v, ok := next()
+		if !ok {
+			break
+		}
+		if leafEntrySize(k, v) > tree.maxEntrySize() {
+			return ErrTooLarge
+		}
+		if l.count > 0 && bytes.Compare(k, l.last) <= 0 {
+			return ErrUnsorted
+		}
+		k = bytes.Clone(k)
+		if err := l.add(k, bytes.Clone(v)); err != nil {
+			return tree.finish(err)
+		}
+		l.last = k
+		l.count++
+	}
+	return tree.finish(l.finish())
+}
+
+// diskLoader builds a disk B+ tree bottom-up like btreeLoader. Every level has
+// the open node cur and the full node pending before it, which is written and
+// added to its parent when cur is full too. Page ids are given when a node is
+// full, so a node merged at the end doesn't take a page.
+type diskLoader struct {
+	tree   *DiskBPlusTree
+	target int
+	levels []*diskLevel
+	id     uint32
+	count  uint64
+	last   []byte
+	page   []byte
+}
+
+// diskLevel is one level of the loader, levels[0] is the leaves. The low keys
+// are the smallest keys in the subtrees of the nodes, which are the separators
+// before them in the parent.
+type diskLevel struct {
+	pending, cur       *diskNode
+	pendingLow, curLow []byte
+}
+
+// add appends the key and the value to the open leaf, which is closed first if
+// they don't fit in the fill factor.
+func (l *diskLoader) add(k, v []byte) error {
+	lv := l.levels[0]
+	if len(lv.cur.keys) > 0 && lv.cur.size()+leafEntrySize(k, v) > l.target {
+		if err := l.close(0); err != nil {
+			return err
+		}
+	}
+	if len(lv.cur.keys) == 0 {
+		lv.curLow = k
+	}
+	lv.cur.keys = append(lv.cur.keys, k)
+	lv.cur.values = append(lv.cur.values, v)
+	return nil
+}
+
+// pushChild appends the page with the low key to the children of the open node
+// of the level, which is closed first if the separator doesn't fit in the fill
+// factor. The level is added if the page is the first one of it.
+func (l *diskLoader) pushChild(level int, low []byte, id uint32) error {
+	if level == len(l.levels) {
+		l.levels = append(l.levels, &diskLevel{cur: &diskNode{kind: internalPage}})
+	}
+	lv := l.levels[level]
+	if len(lv.cur.children) > 0 && lv.cur.size()+internalEntrySize(low) > l.target {
+		if err := l.close(level); err != nil {
+			return err
+		}
+	}
+	if len(lv.cur.children) == 0 {
+		lv.cur.children, lv.curLow = []uint32{id}, low
+		return nil
+	}
+	lv.cur.keys = append(lv.cur.keys, low)
+	lv.cur.children = append(lv.cur.children, id)
+	return nil
+}
+
+// close gives the open node of the level a page and makes it pending, the
+// pending node before it is written and added to the parent level.
+func (l *diskLoader) close(level int) error {
+	lv := l.levels[level]
+	node := lv.cur
+	node.id = l.alloc()
+	if lv.pending != nil {
+		if err := l.flushPending(level, node); err != nil {
+			return err
+		}
+	}
+	lv.pending, lv.pendingLow = node, lv.curLow
+	lv.cur, lv.curLow = &diskNode{kind: node.kind}, nil
+	return nil
+}
+
+// flushPending writes the pending node of the level and adds it to the parent
+// level, next is the node after it which has a page, or nil.
+func (l *diskLoader) flushPending(level int, next *diskNode) error {
+	lv := l.levels[level]
+	if next != nil && next.isLeaf() {
+		lv.pending.next, next.prev = next.id, lv.pending.id
+	}
+	if err := l.write(lv.pending); err != nil {
+		return err
+	}
+	return l.pushChild(level+1, lv.pendingLow, lv.pending.id)
+}
+
+// alloc returns the id of a new page after the end of the file, the free list
+// is left alone so the old header stays valid until the end.
+func (l *diskLoader) alloc() uint32 {
+	l.id++
+	return l.id - 1
+}
+
+// write encodes the node and writes it to its page.
+func (l *diskLoader) write(node *diskNode) error {
+	node.encode(l.page)
+	return l.tree.pager.writePage(node.id, l.page)
+}
+
+// finish closes the levels from the bottom up like btreeLoader.finish, the
+// last node of a level which drops below a quarter of the page is merged with
+// the pending node or balanced with it. Then the pages are synced before the
+// new header is committed.
+func (l *diskLoader) finish() error {
+	tree := l.tree
+	pageSize := tree.pager.pageSize
+	root, height := uint32(0), 0
+	for level := 0; ; level++ {
+		lv := l.levels[level]
+		if lv.pending == nil {
+			if len(lv.cur.keys) > 0 || len(lv.cur.children) > 0 {
+				lv.cur.id = l.alloc()
+				if err := l.write(lv.cur); err != nil {
+					return err
+				}
+				root, height = lv.cur.id, level+1
+			}
+			break
+		}
+		pending, cur := lv.pending, lv.cur
+		merged := false
+		if cur.size() < pageSize/4 || (!cur.isLeaf() && len(cur.children) < 2) {
+			merged = l.rebalance(lv)
+		}
+		if merged && level == len(l.levels)-1 {
+			if err := l.write(pending); err != nil {
+				return err
+			}
+			root, height = pending.id, level+1
+			break
+		}
+		if merged {
+			if err := l.flushPending(level, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		cur.id = l.alloc()
+		if err := l.flushPending(level, cur); err != nil {
+			return err
+		}
+		if err := l.write(cur); err != nil {
+			return err
+		}
+		if err := l.pushChild(level+1, lv.curLow, cur.id); err != nil {
+			return err
+		}
+	}
+	if err := tree.pager.file.Sync(); err != nil {
+		return err
+	}
+	m := &tree.pager.meta
+	m.root, m.height, m.count, m.pageCount = root, uint32(height), l.count, l.id
+	if tree.wal == nil {
+		return tree.flush()
+	}
+	if err := tree.wal.commit(m); err != nil {
+		return err
+	}
+	return tree.checkpoint()
+}
+
+// rebalance merges the open node of the level into the pending node if they
+// fit in one page, otherwise it moves keys between them so both have about
+// the same number of bytes, like DiskBPlusTree.rebalance. It reports whether
+// the nodes are merged.
+func (l *diskLoader) rebalance(lv *diskLevel) bool {
+	pageSize := l.tree.pager.pageSize
+	left, right := lv.pending, lv.cur
+	if left.isLeaf() {
+		keys := append(append(make([][]byte, 0, len(left.keys)+len(right.keys)), left.keys...), right.keys...)
+		values := append(append(make([][]byte, 0, len(keys)), left.values...), right.values...)
+		if left.size()+right.size()-leafHeaderSize <= pageSize {
+			left.keys, left.values = keys, values
+			return true
+		}
+		m := splitIndex(len(keys), 1, 1, func(j int) int {
+			return leafEntrySize(keys[j], values[j])
+		})
+		left.keys, right.keys = keys[:m:m], keys[m:]
+		left.values, right.values = values[:m:m], values[m:]
+		lv.curLow = right.keys[0]
+		return false
+	}
+
+	// the low key of the right node moves down between the keys of the two
+	keys := make([][]byte, 0, len(left.keys)+len(right.keys)+1)
+	keys = append(append(append(keys, left.keys...), lv.curLow), right.keys...)
+	children := append(append(make([]uint32, 0, len(keys)+1), left.children...), right.children...)
+	if left.size()+internalEntrySize(lv.curLow)+right.size()-internalHeaderSize <= pageSize {
+		left.keys, left.children = keys, children
+		return true
+	}
+	m := splitIndex(len(keys), 1, 2, func(j int) int {
+		return internalEntrySize(keys[j])
+	})
+	lv.curLow = keys[m]
+	left.keys, right.keys = keys[:m:m], keys[m+1:]
+	left.children, right.children = children[:m+1:m+1], children[m+1:]
+	return false
+}
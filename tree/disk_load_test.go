@@ -0,0 +1,249 @@
+package tree
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// diskSequence returns n sorted keys and their values, value i has i%40 bytes.
+func diskSequence(n int) ([][]byte, [][]byte) {
+	keys, values := make([][]byte, n), make([][]byte, n)
+	for i := range keys {
+		keys[i], values[i] = diskKey(i), bytes.Repeat([]byte{byte(i)}, i%40)
+	}
+	return keys, values
+}
+
+func TestDiskLoadBuildsValidTrees(t *testing.T) {
+	for _, fill := range []float64{0.1, 0.7, 1} {
+		for _, n := range []int{0, 1, 2, 5, 9, 20, 100, 1000, 5000} {
+			for _, log := range []bool{false, true} {
+				// GIVEN
+				data := &memFile{}
+				opts := DiskOptions{PageSize: 256, CacheSize: 8}
+				if log {
+					opts.WAL = &memFile{}
+				}
+				tree, _ := OpenFile(data, &opts)
+				keys, values := diskSequence(n)
+
+				// WHEN
+				err := tree.Load(fill, keys, values)
+
+				// THEN
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := checkDiskBPlusTree(tree); err != nil {
+					t.Fatalf("fill = %v, %d keys: %v", fill, n, err)
+				}
+				tree.Close()
+				reopened, err := OpenFile(&memFile{data: data.data}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := checkDiskBPlusTree(reopened); err != nil {
+					t.Fatalf("fill = %v, %d keys, reopened: %v", fill, n, err)
+				}
+				got, err := contents(reopened)
+				if err != nil || len(got) != n {
+					t.Fatalf("fill = %v: reopened tree has %d keys, want %d: %v", fill, len(got), n, err)
+				}
+				for i, k := range keys {
+					if got[string(k)] != string(values[i]) {
+						t.Fatalf("fill = %v: key %q has value %q, want %q", fill, k, got[string(k)], values[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDiskLoadFillFactor(t *testing.T) {
+	// GIVEN
+	keys, values := diskSequence(5000)
+	pages := func(fill float64) uint32 {
+		tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 512})
+		if err := tree.Load(fill, keys, values); err != nil {
+			t.Fatal(err)
+		}
+		return tree.pager.meta.pageCount
+	}
+	inserted, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 512})
+	for i, k := range keys {
+		inserted.Put(k, values[i])
+	}
+
+	// WHEN
+	full, half := pages(1), pages(0.5)
+
+	// THEN
+	if full*3 > half*2 {
+		t.Errorf("tree with fill 1 has %d pages, with fill 0.5 has %d", full, half)
+	}
+	if full*3 > inserted.pager.meta.pageCount*2 {
+		t.Errorf("loaded tree has %d pages, inserted tree has %d", full, inserted.pager.meta.pageCount)
+	}
+}
+
+func TestDiskLoadFuncStreams(t *testing.T) {
+	// GIVEN
+	tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 256, CacheSize: 4, WAL: &memFile{}})
+	i := 0
+	k, v := make([]byte, 0, 16), make([]byte, 8)
+	next := func() ([]byte, []byte, bool) {
+		if i == 50000 {
+			return nil, nil, false
+		}
+		// the buffers are reused for every key
+		k = append(k[:0], diskKey(i)...)
+		v[0] = byte(i)
+		i++
+		return k, v, true
+	}
+
+	// WHEN
+	err := tree.LoadFunc(0.9, next)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.pool.nodes) > 4 {
+		t.Errorf("buffer pool has %d pages, want at most 4", len(tree.pool.nodes))
+	}
+	if err := checkDiskBPlusTree(tree); err != nil || tree.Len() != 50000 {
+		t.Fatalf("tree has %d keys: %v", tree.Len(), err)
+	}
+	if got, ok, _ := tree.Get(diskKey(12345)); !ok || got[0] != byte(12345%256) {
+		t.Errorf("Get(%q) = %v, %v", diskKey(12345), got, ok)
+	}
+}
+
+func TestDiskLoadThenWrite(t *testing.T) {
+	// GIVEN
+	tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 256, CacheSize: 8, WAL: &memFile{}})
+	keys, values := diskSequence(2000)
+	tree.Load(1, keys, values)
+	model := make(map[string]string)
+	for i, k := range keys {
+		model[string(k)] = string(values[i])
+	}
+	r := rand.New(rand.NewSource(5))
+
+	// WHEN
+	for i := 0; i < 5000; i++ {
+		k := diskKey(r.Intn(4000))
+		if r.Intn(2) == 0 {
+			tree.Delete(k)
+			delete(model, string(k))
+		} else {
+			v := bytes.Repeat([]byte{byte(i)}, r.Intn(30))
+			tree.Put(k, v)
+			model[string(k)] = string(v)
+		}
+	}
+
+	// THEN
+	if err := checkDiskBPlusTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	got, err := contents(tree)
+	if err != nil || !equalContents(got, model) {
+		t.Errorf("tree has %d keys, want %d: %v", len(got), len(model), err)
+	}
+}
+
+func TestDiskLoadValidatesInput(t *testing.T) {
+	large := make([]byte, 200)
+	cases := []struct {
+		fill float64
+		keys [][]byte
+		err  error
+	}{
+		{0, [][]byte{diskKey(1)}, ErrInvalidFillFactor},
+		{1.5, [][]byte{diskKey(1)}, ErrInvalidFillFactor},
+		{1, [][]byte{diskKey(1), diskKey(3), diskKey(2)}, ErrUnsorted},
+		{1, [][]byte{diskKey(1), diskKey(1)}, ErrUnsorted},
+		{1, [][]byte{diskKey(1), large}, ErrTooLarge},
+	}
+	for _, c := range cases {
+		// GIVEN
+		tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 256, WAL: &memFile{}})
+
+		// WHEN
+		err := tree.Load(c.fill, c.keys, make([][]byte, len(c.keys)))
+
+		// THEN
+		if err != c.err {
+			t.Errorf("Load(%v, %q) = %v, want %v", c.fill, c.keys, err, c.err)
+		}
+		if err := checkDiskBPlusTree(tree); err != nil || tree.Len() != 0 {
+			t.Errorf("tree has %d keys after a failed Load: %v", tree.Len(), err)
+		}
+		if err := tree.Put(diskKey(1), nil); err != nil {
+			t.Errorf("Put() after a failed Load = %v", err)
+		}
+	}
+	tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 256})
+	tree.Put(diskKey(1), nil)
+	if err := tree.Load(1, [][]byte{diskKey(2)}, [][]byte{nil}); err != ErrNotEmpty {
+		t.Errorf("Load() into a tree with keys = %v, want %v", err, ErrNotEmpty)
+	}
+}
+
+func TestDiskLoadCrash(t *testing.T) {
+	keys, values := diskSequence(1000)
+	for _, policy := range []SyncPolicy{SyncAlways, SyncNone} {
+		opts := DiskOptions{PageSize: 256, CacheSize: 4, Sync: policy}
+
+		// count the bytes written by loading without a crash
+		budget := -1
+		data, log := &faultFile{budget: &budget}, &faultFile{budget: &budget}
+		opts.WAL = log
+		tree, _ := OpenFile(data, &opts)
+		data.checkWAL(log, false)
+		budget = 1 << 30
+		tree.Load(1, keys, values)
+		total := 1<<30 - budget
+		if data.broken != nil {
+			t.Fatalf("policy %d: %v", policy, data.broken)
+		}
+
+		r := rand.New(rand.NewSource(9))
+		for n := 0; n < 200; n++ {
+			// GIVEN
+			cut := r.Intn(total)
+			budget = -1
+			data, log := &faultFile{budget: &budget}, &faultFile{budget: &budget}
+			opts.WAL = log
+			tree, _ := OpenFile(data, &opts)
+			data.checkWAL(log, false)
+			budget = cut
+
+			// WHEN
+			err := tree.Load(1, keys, values)
+			// the crash loses everything which isn't synced
+			reopened, rerr := reopen(&data.durable, &log.durable, DiskOptions{})
+
+			// THEN
+			if err == nil {
+				t.Fatalf("policy %d, crash at byte %d: Load() should fail", policy, cut)
+			}
+			if data.broken != nil {
+				t.Fatalf("policy %d, crash at byte %d: %v", policy, cut, data.broken)
+			}
+			if rerr != nil {
+				t.Fatalf("policy %d, crash at byte %d: reopen = %v", policy, cut, rerr)
+			}
+			if err := checkDiskBPlusTree(reopened); err != nil {
+				t.Fatalf("policy %d, crash at byte %d: %v", policy, cut, err)
+			}
+			// the load is all or nothing
+			if reopened.Len() != 0 && reopened.Len() != len(keys) {
+				t.Fatalf("policy %d, crash at byte %d: reopened tree has %d keys", policy, cut, reopened.Len())
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package tree
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+)
+
+// Kinds of the pages of the disk B+ tree, the first byte of a page.
+const (
+	leafPage     byte = 1
+	internalPage byte = 2
+	freePage     byte = 3
+)
+
+// Sizes of the fixed parts of the pages. A leaf page starts with the kind, the
+// number of keys, and the previous and the next leaf; an internal page starts
+// with the kind, the number of keys and the first child; a free page starts
+// with the kind and the next free page.
+const (
+	leafHeaderSize     = 1 + 2 + 4 + 4
+	internalHeaderSize = 1 + 2 + 4
+	freeHeaderSize     = 1 + 4
+)
+
+// diskNode is a decoded page of the disk B+ tree, which is cached by the
+// buffer pool. A leaf holds keys and values and is linked to its neighbours by
+// prev and next, an internal node holds separator keys and the page ids of the
+// children like bpNode, and a free page holds the next free page in next.
+// Keys and values are never modified in place, so they can be shared between
+// nodes. Pins, dirty and inTxn are the bookkeeping of the buffer pool.
+type diskNode struct {
+	id       uint32
+	kind     byte
+	keys     [][]byte
+	values   [][]byte
+	children []uint32
+	prev     uint32
+	next     uint32
+
+	pins  int
+	dirty bool
+	inTxn bool
+	elem  *list.Element
+}
+
+// isLeaf reports whether the node is a leaf.
+func (node *diskNode) isLeaf() bool {
+	return node.kind == leafPage
+}
+
+// reset turns the node into an empty node of the kind.
+func (node *diskNode) reset(kind byte) {
+	node.kind = kind
+	node.keys, node.values, node.children = nil, nil, nil
+	node.prev, node.next = 0, 0
+}
+
+// size returns the number of bytes of the encoded node.
+func (node *diskNode) size() int {
+	switch node.kind {
+	case leafPage:
+		n := leafHeaderSize
+		for i := range node.keys {
+			n += leafEntrySize(node.keys[i], node.values[i])
+		}
+		return n
+	case internalPage:
+		n := internalHeaderSize
+		for _, k := range node.keys {
+			n += internalEntrySize(k)
+		}
+		return n
+	}
+	return freeHeaderSize
+}
+
+// leafEntrySize returns the number of bytes of one key and value in a leaf.
+func leafEntrySize(k, v []byte) int {
+	return 2 + 2 + len(k) + len(v)
+}
+
+// internalEntrySize returns the number of bytes of one separator key and the
+// child after it in an internal node.
+func internalEntrySize(k []byte) int {
+	return 2 + len(k) + 4
+}
+
+// encode encodes the node into the page, the page must be at least as large
+// as the size of the node, and the rest of the page is zeroed.
+func (node *diskNode) encode(page []byte) {
+	page[0] = node.kind
+	off := 1
+	switch node.kind {
+	case leafPage:
+		binary.LittleEndian.PutUint16(page[1:], uint16(len(node.keys)))
+		binary.LittleEndian.PutUint32(page[3:], node.prev)
+		binary.LittleEndian.PutUint32(page[7:], node.next)
+		off = leafHeaderSize
+		for i, k := range node.keys {
+			v := node.values[i]
+			binary.LittleEndian.PutUint16(page[off:], uint16(len(k)))
+			binary.LittleEndian.PutUint16(page[off+2:], uint16(len(v)))
+			off += 4
+			off += copy(page[off:], k)
+			off += copy(page[off:], v)
+		}
+	case internalPage:
+		binary.LittleEndian.PutUint16(page[1:], uint16(len(node.keys)))
+		binary.LittleEndian.PutUint32(page[3:], node.children[0])
+		off = internalHeaderSize
+		for i, k := range node.keys {
+			binary.LittleEndian.PutUint16(page[off:], uint16(len(k)))
+			off += 2
+			off += copy(page[off:], k)
+			binary.LittleEndian.PutUint32(page[off:], node.children[i+1])
+			off += 4
+		}
+	case freePage:
+		binary.LittleEndian.PutUint32(page[1:], node.next)
+		off = freeHeaderSize
+	}
+	for i := off; i < len(page); i++ {
+		page[i] = 0
+	}
+}
+
+// decodeNode decodes the page with the id, keys and values are copied out of
+// the page. It returns ErrCorrupt if the page is not a valid node.
+func decodeNode(id uint32, page []byte) (*diskNode, error) {
+	node := &diskNode{id: id, kind: page[0]}
+	switch node.kind {
+	case leafPage:
+		n := int(binary.LittleEndian.Uint16(page[1:]))
+		node.prev = binary.LittleEndian.Uint32(page[3:])
+		node.next = binary.LittleEndian.Uint32(page[7:])
+		node.keys = make([][]byte, 0, n)
+		node.values = make([][]byte, 0, n)
+		off := leafHeaderSize
+		for i := 0; i < n; i++ {
+			if off+4 > len(page) {
+				return nil, ErrCorrupt
+			}
+			klen := int(binary.LittleEndian.Uint16(page[off:]))
+			vlen := int(binary.LittleEndian.Uint16(page[off+2:]))
+			off += 4
+			if off+klen+vlen > len(page) {
+				return nil, ErrCorrupt
+			}
+			node.keys = append(node.keys, bytes.Clone(page[off:off+klen]))
+			off += klen
+			node.values = append(node.values, bytes.Clone(page[off:off+vlen]))
+			off += vlen
+		}
+	case internalPage:
+		n := int(binary.LittleEndian.Uint16(page[1:]))
+		node.keys = make([][]byte, 0, n)
+		node.children = make([]uint32, 0, n+1)
+		node.children = append(node.children, binary.LittleEndian.Uint32(page[3:]))
+		off := internalHeaderSize
+		for i := 0; i < n; i++ {
+			if off+2 > len(page) {
+				return nil, ErrCorrupt
+			}
+			klen := int(binary.LittleEndian.Uint16(page[off:]))
+			off += 2
+			if off+klen+4 > len(page) {
+				return nil, ErrCorrupt
+			}
+			node.keys = append(node.keys, bytes.Clone(page[off:off+klen]))
+			off += klen
+			node.children = append(node.children, binary.LittleEndian.Uint32(page[off:]))
+			off += 4
+		}
+	case freePage:
+		node.next = binary.LittleEndian.Uint32(page[1:])
+	default:
+		return nil, ErrCorrupt
+	}
+	return node, nil
+}
+
+// index returns the index of the first key not less than k in the node, and
+// reports whether the key at the index equals k.
+func (node *diskNode) index(k []byte) (int, bool) {
+	lo, hi := 0, len(node.keys)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if bytes.Compare(node.keys[mid], k) < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(node.keys) && bytes.Equal(node.keys[lo], k)
+}
+
+// childIndex returns the index of the child which the key belongs to, it's
+// the number of separator keys not greater than the key.
+func (node *diskNode) childIndex(k []byte) int {
+	lo, hi := 0, len(node.keys)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if bytes.Compare(node.keys[mid], k) <= 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// splitIndex returns the index where n entries are split into two halves of
+// about the same number of bytes, size returns the bytes of the i-th entry.
+// The result is in [lo, n-hi], so each half keeps enough entries.
+func splitIndex(n, lo, hi int, size func(i int) int) int {
+	total := 0
+	for i := 0; i < n; i++ {
+		total += size(i)
+	}
+	m, acc := 0, 0
+	for m < n && 2*acc < total {
+		acc += size(m)
+		m++
+	}
+	if m < lo {
+		m = lo
+	}
+	if m > n-hi {
+		m = n - hi
+	}
+	return m
+}
@@ -0,0 +1,164 @@
+package tree
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// File is the file which the disk B+ tree is stored in, *os.File implements
+// it. It's an interface so that tests can inject faults into reads and writes.
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// Errors of the disk B+ tree.
+var (
+	ErrCorrupt         = errors.New("tree: file is corrupt")
+	ErrInvalidPageSize = errors.New("tree: page size must be a power of two between 256 and 65536")
+	ErrTooLarge        = errors.New("tree: key and value are too large for the page size")
+	ErrClosed          = errors.New("tree: disk B+ tree is closed")
+)
+
+// DefaultPageSize is the page size of a new file if it's not set in the
+// options.
+const DefaultPageSize = 4096
+
+// headerMagic is the first bytes of the file, the last byte is the version of
+// the file format.
+var headerMagic = [8]byte{'d', 's', 'a', 'l', 'b', 'p', 't', 1}
+
+// headerSize is the number of bytes of the header at the beginning of page 0:
+// the magic, the page size, the root, the number of pages, the first free
+// page, the height, the number of keys and the checksum of all of them.
+const headerSize = 8 + 4 + 4 + 4 + 4 + 4 + 8 + 4
+
+// diskMeta is the metadata of the disk B+ tree stored in the header. Page 0 is
+// the header itself, so page id 0 means no page for root and freeHead.
+type diskMeta struct {
+	pageSize  uint32
+	root      uint32
+	pageCount uint32
+	freeHead  uint32
+	height    uint32
+	count     uint64
+}
+
+// encode encodes the metadata into the header.
+func (m *diskMeta) encode(b []byte) {
+	copy(b, headerMagic[:])
+	binary.LittleEndian.PutUint32(b[8:], m.pageSize)
+	binary.LittleEndian.PutUint32(b[12:], m.root)
+	binary.LittleEndian.PutUint32(b[16:], m.pageCount)
+	binary.LittleEndian.PutUint32(b[20:], m.freeHead)
+	binary.LittleEndian.PutUint32(b[24:], m.height)
+	binary.LittleEndian.PutUint64(b[28:], m.count)
+	binary.LittleEndian.PutUint32(b[36:], crc32.ChecksumIEEE(b[:36]))
+}
+
+// decode decodes the metadata from the header, it returns ErrCorrupt if the
+// magic or the checksum doesn't match.
+func (m *diskMeta) decode(b []byte) error {
+	if [8]byte(b[:8]) != headerMagic {
+		return ErrCorrupt
+	}
+	if binary.LittleEndian.Uint32(b[36:]) != crc32.ChecksumIEEE(b[:36]) {
+		return ErrCorrupt
+	}
+	m.pageSize = binary.LittleEndian.Uint32(b[8:])
+	m.root = binary.LittleEndian.Uint32(b[12:])
+	m.pageCount = binary.LittleEndian.Uint32(b[16:])
+	m.freeHead = binary.LittleEndian.Uint32(b[20:])
+	m.height = binary.LittleEndian.Uint32(b[24:])
+	m.count = binary.LittleEndian.Uint64(b[28:])
+	if validPageSize(int(m.pageSize)) != nil || m.pageCount == 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// validPageSize returns ErrInvalidPageSize if the page size is not a power of
+// two between 256 and 65536.
+func validPageSize(size int) error {
+	if size < 256 || size > 1<<16 || size&(size-1) != 0 {
+		return ErrInvalidPageSize
+	}
+	return nil
+}
+
+// pager reads and writes fixed-size pages of the file, page i is at the
+// offset i*pageSize. It also holds the metadata, which is written to page 0
+// by writeHeader.
+type pager struct {
+	file     File
+	pageSize int
+	meta     diskMeta
+}
+
+// openPager reads the header of the file, or writes a new header with the page
+// size if the file is empty.
+func openPager(file File, pageSize int) (*pager, error) {
+	b := make([]byte, headerSize)
+	n, err := file.ReadAt(b, 0)
+	if n == 0 && err == io.EOF {
+		if err := validPageSize(pageSize); err != nil {
+			return nil, err
+		}
+		p := &pager{file: file, pageSize: pageSize}
+		p.meta = diskMeta{pageSize: uint32(pageSize), pageCount: 1}
+		if err := p.writeHeader(); err != nil {
+			return nil, err
+		}
+		if err := file.Sync(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	if n < headerSize {
+		if err == nil || err == io.EOF {
+			err = ErrCorrupt
+		}
+		return nil, err
+	}
+	p := &pager{file: file}
+	if err := p.meta.decode(b); err != nil {
+		return nil, err
+	}
+	p.pageSize = int(p.meta.pageSize)
+	return p, nil
+}
+
+// readPage reads the page with the id into the buffer.
+func (p *pager) readPage(id uint32, page []byte) error {
+	if id == 0 || id >= p.meta.pageCount {
+		return ErrCorrupt
+	}
+	n, err := p.file.ReadAt(page, int64(id)*int64(p.pageSize))
+	if n == len(page) {
+		return nil
+	}
+	if err == io.EOF {
+		err = ErrCorrupt
+	}
+	return err
+}
+
+// writePage writes the buffer to the page with the id.
+func (p *pager) writePage(id uint32, page []byte) error {
+	_, err := p.file.WriteAt(page, int64(id)*int64(p.pageSize))
+	return err
+}
+
+// writeHeader writes the metadata to the header, the rest of page 0 is left
+// unused.
+func (p *pager) writeHeader() error {
+	b := make([]byte, headerSize)
+	p.meta.encode(b)
+	_, err := p.file.WriteAt(b, 0)
+	return err
+}
@@ -0,0 +1,165 @@
+package tree
+
+import "container/list"
+
+// bufferPool caches decoded pages of the pager. A fetched page is pinned and
+// never evicted until it's unpinned, the unpinned pages are kept in LRU order
+// and the least recently used one is evicted when the pool is full. A dirty
+// page is written back to the pager when it's evicted or flushed.
+//
+// The capacity is a soft limit: when every cached page is pinned, the pool
+// grows beyond it rather than failing, and shrinks back as pages are
+// unpinned and evicted.
+//
+// With a write-ahead log, a page modified by the current operation stays
+// pinned until the operation is committed to the log, and the log is synced
+// before a dirty page is written, so the data file never holds a page which
+// the log can't redo.
+type bufferPool struct {
+	pager    *pager
+	capacity int
+	nodes    map[uint32]*diskNode
+	// lru holds the unpinned nodes, the front is the most recently used.
+	lru  *list.List
+	page []byte
+	wal  *wal
+	// txn holds the nodes modified by the current operation.
+	txn []*diskNode
+}
+
+// newBufferPool returns an empty buffer pool of the pager which caches up to
+// capacity pages.
+func newBufferPool(p *pager, capacity int) *bufferPool {
+	return &bufferPool{
+		pager:    p,
+		capacity: capacity,
+		nodes:    make(map[uint32]*diskNode),
+		lru:      list.New(),
+		page:     make([]byte, p.pageSize),
+	}
+}
+
+// fetch returns the pinned node of the page with the id, the page is read from
+// the pager if it's not cached.
+func (pool *bufferPool) fetch(id uint32) (*diskNode, error) {
+	if node, ok := pool.nodes[id]; ok {
+		pool.pin(node)
+		return node, nil
+	}
+	if err := pool.evict(); err != nil {
+		return nil, err
+	}
+	if err := pool.pager.readPage(id, pool.page); err != nil {
+		return nil, err
+	}
+	node, err := decodeNode(id, pool.page)
+	if err != nil {
+		return nil, err
+	}
+	node.pins = 1
+	pool.nodes[id] = node
+	return node, nil
+}
+
+// create caches a new empty node of the kind for the page with the id, which
+// is not in the file yet. The node is pinned and dirty.
+func (pool *bufferPool) create(id uint32, kind byte) (*diskNode, error) {
+	if err := pool.evict(); err != nil {
+		return nil, err
+	}
+	node := &diskNode{id: id, kind: kind, pins: 1}
+	pool.nodes[id] = node
+	pool.markDirty(node)
+	return node, nil
+}
+
+// pin pins the cached node, it's removed from the LRU list when the first pin
+// is taken.
+func (pool *bufferPool) pin(node *diskNode) {
+	if node.pins == 0 {
+		pool.lru.Remove(node.elem)
+		node.elem = nil
+	}
+	node.pins++
+}
+
+// unpin releases one pin of the node, the node becomes the most recently used
+// one when the last pin is released.
+func (pool *bufferPool) unpin(node *diskNode) {
+	node.pins--
+	if node.pins == 0 {
+		node.elem = pool.lru.PushFront(node)
+	}
+}
+
+// markDirty marks the node as modified, so it's written back before being
+// evicted. With a log, the node is also pinned for the current operation.
+func (pool *bufferPool) markDirty(node *diskNode) {
+	node.dirty = true
+	if pool.wal != nil && !node.inTxn {
+		node.inTxn = true
+		pool.pin(node)
+		pool.txn = append(pool.txn, node)
+	}
+}
+
+// logTxn appends the images of the nodes modified by the current operation to
+// the log, the operation is committed by the caller.
+func (pool *bufferPool) logTxn() {
+	for _, node := range pool.txn {
+		node.encode(pool.page)
+		pool.wal.appendRecord(walPage, node.id, pool.page)
+	}
+}
+
+// endTxn unpins the nodes of the current operation after it's committed.
+func (pool *bufferPool) endTxn() {
+	for _, node := range pool.txn {
+		node.inTxn = false
+		pool.unpin(node)
+	}
+	pool.txn = pool.txn[:0]
+}
+
+// evict evicts the least recently used unpinned nodes until there is room for
+// one more node, dirty nodes are written back first.
+func (pool *bufferPool) evict() error {
+	for len(pool.nodes) >= pool.capacity && pool.lru.Len() > 0 {
+		node := pool.lru.Back().Value.(*diskNode)
+		if node.dirty {
+			if err := pool.write(node); err != nil {
+				return err
+			}
+		}
+		pool.lru.Remove(node.elem)
+		delete(pool.nodes, node.id)
+	}
+	return nil
+}
+
+// write encodes the node and writes it to its page, the log is synced first.
+func (pool *bufferPool) write(node *diskNode) error {
+	if pool.wal != nil {
+		if err := pool.wal.sync(); err != nil {
+			return err
+		}
+	}
+	node.encode(pool.page)
+	if err := pool.pager.writePage(node.id, pool.page); err != nil {
+		return err
+	}
+	node.dirty = false
+	return nil
+}
+
+// flush writes back all dirty nodes.
+func (pool *bufferPool) flush() error {
+	for _, node := range pool.nodes {
+		if node.dirty {
+			if err := pool.write(node); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package tree
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// SyncPolicy decides when the write-ahead log is committed to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs the log at every commit, so an operation is durable
+	// once it returns.
+	SyncAlways SyncPolicy = iota
+	// SyncBatch syncs the log after every DiskOptions.BatchSize commits, a
+	// crash loses at most the operations of the last batch.
+	SyncBatch
+	// SyncNone never syncs the log until Sync, Checkpoint or Close, a crash
+	// may lose any operation after the last of them.
+	SyncNone
+)
+
+// DefaultBatchSize is the number of commits between syncs of SyncBatch if it's
+// not set in the options.
+const DefaultBatchSize = 32
+
+// DefaultCheckpointSize is the size in bytes of the log which triggers a
+// checkpoint if it's not set in the options.
+const DefaultCheckpointSize = 4 << 20
+
+// Kinds of the records of the log. A page record holds the image of one page
+// modified by an operation, a commit record holds the header after the
+// operation and ends it.
+const (
+	walPage   byte = 1
+	walCommit byte = 2
+)
+
+// walRecordHeaderSize is the size of the header of a record: the checksum of
+// the rest of the record, the kind, the page id and the size of the payload.
+const walRecordHeaderSize = 4 + 1 + 4 + 4
+
+// wal is the write-ahead log of the disk B+ tree. Every operation appends the
+// images of the pages it modified and a commit record, and a modified page is
+// written to the data file only after its record is synced. Recovery redoes
+// the committed operations by writing their page images to the data file, the
+// records after the last commit are ignored, so an operation is all or
+// nothing. A checkpoint writes all pages to the data file and truncates the
+// log.
+type wal struct {
+	file    File
+	policy  SyncPolicy
+	batch   int
+	size    int64
+	commits int
+	dirty   bool
+	buf     []byte
+}
+
+// newWAL returns a log writing to the file, which must be empty or truncated
+// by reset before appending.
+func newWAL(f File, policy SyncPolicy, batch int) *wal {
+	return &wal{file: f, policy: policy, batch: batch}
+}
+
+// appendRecord appends a record to the buffer of the current operation.
+func (w *wal) appendRecord(kind byte, id uint32, payload []byte) {
+	start := len(w.buf)
+	w.buf = append(w.buf, make([]byte, walRecordHeaderSize)...)
+	w.buf = append(w.buf, payload...)
+	rec := w.buf[start:]
+	rec[4] = kind
+	binary.LittleEndian.PutUint32(rec[5:], id)
+	binary.LittleEndian.PutUint32(rec[9:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(rec, crc32.ChecksumIEEE(rec[4:]))
+}
+
+// commit appends the commit record with the header, writes the records of the
+// operation to the log, and syncs it according to the policy.
+func (w *wal) commit(m *diskMeta) error {
+	header := make([]byte, headerSize)
+	m.encode(header)
+	w.appendRecord(walCommit, 0, header)
+	n, err := w.file.WriteAt(w.buf, w.size)
+	w.size += int64(n)
+	w.buf = w.buf[:0]
+	if err != nil {
+		return err
+	}
+	w.dirty = true
+	w.commits++
+	if w.policy == SyncAlways || (w.policy == SyncBatch && w.commits >= w.batch) {
+		return w.sync()
+	}
+	return nil
+}
+
+// sync commits the log to stable storage if it's written since the last sync.
+func (w *wal) sync() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.dirty, w.commits = false, 0
+	return nil
+}
+
+// reset truncates the log after all of its operations are in the data file.
+func (w *wal) reset() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.size, w.dirty, w.commits = 0, false, 0
+	return nil
+}
+
+// replay reads the log from the beginning and calls apply with the pages of
+// every committed operation in order. It stops at the end of the log, at a
+// torn or corrupt record, or at the records of an operation without commit,
+// and returns the header of the last committed operation and whether there is
+// one.
+func (w *wal) replay(apply func(id uint32, page []byte) error) (diskMeta, bool, error) {
+	var meta diskMeta
+	committed := false
+	type pageRecord struct {
+		id   uint32
+		page []byte
+	}
+	var pending []pageRecord
+	header := make([]byte, walRecordHeaderSize)
+	for off := int64(0); ; {
+		if n, _ := w.file.ReadAt(header, off); n < len(header) {
+			break
+		}
+		size := binary.LittleEndian.Uint32(header[9:])
+		if size > 1<<16 {
+			break
+		}
+		rec := make([]byte, walRecordHeaderSize+int(size))
+		if n, _ := w.file.ReadAt(rec, off); n < len(rec) {
+			break
+		}
+		if binary.LittleEndian.Uint32(rec) != crc32.ChecksumIEEE(rec[4:]) {
+			break
+		}
+		off += int64(len(rec))
+		id, payload := binary.LittleEndian.Uint32(rec[5:]), rec[walRecordHeaderSize:]
+		if rec[4] == walPage {
+			pending = append(pending, pageRecord{id, payload})
+			continue
+		}
+		var next diskMeta
+		if rec[4] != walCommit || len(payload) != headerSize || next.decode(payload) != nil {
+			break
+		}
+		for _, p := range pending {
+			if len(p.page) != int(next.pageSize) {
+				return meta, committed, ErrCorrupt
+			}
+			if err := apply(p.id, p.page); err != nil {
+				return meta, committed, err
+			}
+		}
+		meta, pending, committed = next, pending[:0], true
+	}
+	return meta, committed, nil
+}
+
+// recover redoes the committed operations of the log in the data file, then
+// makes the data file durable and truncates the log. The pager is the one
+// opened from the header of the data file, or nil with the error if the header
+// can't be read, which is recovered from the log too.
+func (w *wal) recover(f File, p *pager, openErr error) (*pager, error) {
+	meta, committed, err := w.replay(func(id uint32, page []byte) error {
+		_, err := f.WriteAt(page, int64(id)*int64(len(page)))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if committed {
+		p, openErr = &pager{file: f, pageSize: int(meta.pageSize), meta: meta}, nil
+		if err := p.writeHeader(); err != nil {
+			return nil, err
+		}
+		if err := f.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	if openErr != nil {
+		return nil, openErr
+	}
+	return p, w.reset()
+}
@@ -0,0 +1,488 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// errCrash is returned by faultFile after the crash.
+var errCrash = errors.New("crash")
+
+// faultFile is a memFile which crashes after a number of bytes are written. The
+// budget is shared by all files of a tree, the write across the crash point is
+// torn, and every write, sync and truncate after it fails. Writes and
+// truncates only reach durable when the file is synced, so durable is what a
+// crash leaves on the disk.
+//
+// A data file with its log set by checkWAL checks the rule of the write-ahead
+// log: every page and header written to it must be the image of a committed
+// operation in the synced part of the log, the first write breaking it is kept
+// in broken.
+type faultFile struct {
+	memFile
+	budget  *int
+	durable memFile
+	pending []func(f *memFile)
+	log     *faultFile
+	pages   bool // whether the pages are checked besides the header
+	broken  error
+	// images holds the page and header images of the committed operations in
+	// the synced part of a log checked by checkWAL, keyed by walImage, parsed
+	// is the size of the part which has been read.
+	images map[string]bool
+	parsed int
+}
+
+func (f *faultFile) WriteAt(p []byte, off int64) (int, error) {
+	if f.log != nil && f.broken == nil && (off == 0 || f.pages) && !f.log.images[walImage(off, p)] {
+		f.broken = fmt.Errorf("%d bytes at offset %d are written before their log record is synced", len(p), off)
+	}
+	var err error
+	if *f.budget >= 0 {
+		if *f.budget < len(p) {
+			p, err = p[:*f.budget], errCrash
+			*f.budget = 0
+		} else {
+			*f.budget -= len(p)
+		}
+	}
+	p = bytes.Clone(p)
+	f.pending = append(f.pending, func(d *memFile) { d.WriteAt(p, off) })
+	n, _ := f.memFile.WriteAt(p, off)
+	return n, err
+}
+
+func (f *faultFile) Sync() error {
+	if *f.budget == 0 {
+		return errCrash
+	}
+	for _, apply := range f.pending {
+		apply(&f.durable)
+	}
+	f.pending = nil
+	if f.images != nil {
+		f.readImages()
+	}
+	return f.memFile.Sync()
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	if *f.budget == 0 {
+		return errCrash
+	}
+	f.pending = append(f.pending, func(d *memFile) { d.Truncate(size) })
+	return f.memFile.Truncate(size)
+}
+
+// walImage returns the key of the image written at the offset of the data file,
+// the header is at offset 0 and a page at its id times the page size.
+func walImage(off int64, p []byte) string {
+	return fmt.Sprintf("%d:%s", off, p)
+}
+
+// readImages reads the records synced since the last call, the log is read
+// from the beginning again after it's truncated. A sync always ends at a
+// commit record, so only committed images are kept.
+func (f *faultFile) readImages() {
+	if f.images == nil || len(f.durable.data) < f.parsed {
+		f.images, f.parsed = make(map[string]bool), 0
+	}
+	data := f.durable.data
+	for off := f.parsed; off+walRecordHeaderSize <= len(data); {
+		id := binary.LittleEndian.Uint32(data[off+5:])
+		size := int(binary.LittleEndian.Uint32(data[off+9:]))
+		if off+walRecordHeaderSize+size > len(data) {
+			break
+		}
+		payload := data[off+walRecordHeaderSize : off+walRecordHeaderSize+size]
+		if data[off+4] == walPage {
+			f.images[walImage(int64(id)*int64(size), payload)] = true
+		} else {
+			f.images[walImage(0, payload)] = true
+		}
+		off += walRecordHeaderSize + size
+	}
+	f.parsed = len(data)
+}
+
+// checkWAL makes the file check the rule of the write-ahead log with the log,
+// for the header only unless pages is true, since a bulk load writes its new
+// pages without logging them.
+func (f *faultFile) checkWAL(log *faultFile, pages bool) {
+	f.log, f.pages, log.images = log, pages, make(map[string]bool)
+}
+
+// reopen opens the tree again from the bytes left in the files, like the
+// process restarting after a crash.
+func reopen(data, log *memFile, opts DiskOptions) (*DiskBPlusTree, error) {
+	opts.WAL = &memFile{data: bytes.Clone(log.data)}
+	return OpenFile(&memFile{data: bytes.Clone(data.data)}, &opts)
+}
+
+// walOps is a deterministic sequence of operations, a nil value is a delete.
+type walOp struct {
+	key   []byte
+	value []byte
+}
+
+func walOps(n int) []walOp {
+	r := rand.New(rand.NewSource(int64(n)))
+	ops := make([]walOp, n)
+	for i := range ops {
+		ops[i].key = diskKey(r.Intn(200))
+		if r.Intn(3) != 0 {
+			ops[i].value = bytes.Repeat([]byte{byte(i)}, 1+r.Intn(30))
+		}
+	}
+	return ops
+}
+
+// applyOps applies the operations to the tree until one fails, and returns the
+// number of operations which succeeded.
+func applyOps(tree *DiskBPlusTree, ops []walOp) int {
+	for i, op := range ops {
+		var err error
+		if op.value == nil {
+			_, err = tree.Delete(op.key)
+		} else {
+			err = tree.Put(op.key, op.value)
+		}
+		if err != nil {
+			return i
+		}
+	}
+	return len(ops)
+}
+
+// snapshots returns the contents of the tree after every prefix of the
+// operations, snapshots[i] is the contents after the first i operations.
+func snapshots(ops []walOp) []map[string]string {
+	states := []map[string]string{{}}
+	for _, op := range ops {
+		next := make(map[string]string, len(states[len(states)-1]))
+		for k, v := range states[len(states)-1] {
+			next[k] = v
+		}
+		if op.value == nil {
+			delete(next, string(op.key))
+		} else {
+			next[string(op.key)] = string(op.value)
+		}
+		states = append(states, next)
+	}
+	return states
+}
+
+// contents returns all keys and values of the tree.
+func contents(tree *DiskBPlusTree) (map[string]string, error) {
+	m := make(map[string]string)
+	err := tree.Ascend(func(k, v []byte) bool {
+		m[string(k)] = string(v)
+		return true
+	})
+	return m, err
+}
+
+func equalContents(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWALReplayStopsAtTornRecord(t *testing.T) {
+	// GIVEN
+	log := &memFile{}
+	w := newWAL(log, SyncAlways, 1)
+	page := bytes.Repeat([]byte{leafPage}, 256)
+	for id := uint32(1); id <= 3; id++ {
+		w.appendRecord(walPage, id, page)
+		if err := w.commit(&diskMeta{pageSize: 256, pageCount: id + 1, count: uint64(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := len(log.data)
+
+	// WHEN
+	log.data = log.data[:size-10]
+	var ids []uint32
+	meta, ok, err := w.replay(func(id uint32, page []byte) error {
+		ids = append(ids, id)
+		return nil
+	})
+
+	// THEN
+	if err != nil || !ok || meta.count != 2 || !equalUint32s(ids, []uint32{1, 2}) {
+		t.Errorf("replay() = %+v, %v, %v, pages %v, want the first two operations", meta, ok, err, ids)
+	}
+	log.data = log.data[:size]
+	log.data[size/2] ^= 0xff
+	ids = nil
+	if meta, _, _ = w.replay(func(id uint32, page []byte) error {
+		ids = append(ids, id)
+		return nil
+	}); meta.count != 1 || !equalUint32s(ids, []uint32{1}) {
+		t.Errorf("replay() of corrupt record = %+v, pages %v, want the first operation", meta, ids)
+	}
+}
+
+func equalUint32s(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWALSyncPolicies(t *testing.T) {
+	cases := []struct {
+		policy SyncPolicy
+		syncs  int
+	}{
+		{SyncAlways, 20},
+		{SyncBatch, 5},
+		{SyncNone, 0},
+	}
+	for _, c := range cases {
+		// GIVEN
+		log := &memFile{}
+		tree, err := OpenFile(&memFile{}, &DiskOptions{PageSize: 256, WAL: log, Sync: c.policy, BatchSize: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		syncs := log.syncs
+
+		// WHEN
+		for i := 0; i < 20; i++ {
+			tree.Put(diskKey(i), nil)
+		}
+
+		// THEN
+		if got := log.syncs - syncs; got != c.syncs {
+			t.Errorf("policy %d syncs the log %d times, want %d", c.policy, got, c.syncs)
+		}
+		syncs = log.syncs
+		tree.Sync()
+		if c.policy == SyncNone && log.syncs != syncs+1 {
+			t.Errorf("Sync() should sync the log")
+		}
+	}
+}
+
+func TestCheckpointTruncatesWAL(t *testing.T) {
+	// GIVEN
+	data, log := &memFile{}, &memFile{}
+	tree, _ := OpenFile(data, &DiskOptions{PageSize: 256, WAL: log})
+	for i := 0; i < 100; i++ {
+		tree.Put(diskKey(i), diskKey(i))
+	}
+	if len(log.data) == 0 {
+		t.Fatal("operations should be written to the log")
+	}
+
+	// WHEN
+	err := tree.Checkpoint()
+
+	// THEN
+	if err != nil || len(log.data) != 0 {
+		t.Fatalf("Checkpoint() = %v, log has %d bytes, want it truncated", err, len(log.data))
+	}
+	reopened, err := reopen(data, log, DiskOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDiskBPlusTree(reopened); err != nil || reopened.Len() != 100 {
+		t.Errorf("reopened tree has %d keys: %v", reopened.Len(), err)
+	}
+}
+
+func TestCheckpointWhenWALIsLarge(t *testing.T) {
+	// GIVEN
+	log := &memFile{}
+	tree, _ := OpenFile(&memFile{}, &DiskOptions{PageSize: 256, WAL: log, CheckpointSize: 4096})
+
+	// WHEN
+	for i := 0; i < 200; i++ {
+		tree.Put(diskKey(i), diskKey(i))
+	}
+
+	// THEN
+	if len(log.data) >= 4096 {
+		t.Errorf("log has %d bytes, it should be checkpointed at 4096", len(log.data))
+	}
+}
+
+func TestRecoverWithoutClose(t *testing.T) {
+	// GIVEN
+	data, log := &memFile{}, &memFile{}
+	opts := DiskOptions{PageSize: 256, CacheSize: 4, WAL: log}
+	tree, _ := OpenFile(data, &opts)
+	ops := walOps(500)
+	applyOps(tree, ops)
+
+	// WHEN
+	// the process exits without Close, and the data file only has the pages
+	// which were evicted
+	reopened, err := reopen(data, log, opts)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDiskBPlusTree(reopened); err != nil {
+		t.Fatal(err)
+	}
+	got, err := contents(reopened)
+	if want := snapshots(ops)[len(ops)]; err != nil || !equalContents(got, want) {
+		t.Errorf("reopened tree has %d keys, want %d", len(got), len(want))
+	}
+}
+
+// applyOpsWithSyncs applies the operations like applyOps, and calls Sync and
+// Checkpoint by turns after every 25 operations. It returns the number of
+// operations which succeeded and the number of them which are acknowledged as
+// durable, either by the policy or by a Sync or Checkpoint which succeeded.
+func applyOpsWithSyncs(tree *DiskBPlusTree, ops []walOp, policy SyncPolicy) (int, int) {
+	acked := 0
+	for i := 0; i < len(ops); i += 25 {
+		end := i + 25
+		if end > len(ops) {
+			end = len(ops)
+		}
+		done := i + applyOps(tree, ops[i:end])
+		if policy == SyncAlways {
+			acked = done
+		}
+		if done < end {
+			return done, acked
+		}
+		sync := tree.Sync
+		if i/25%2 == 1 {
+			sync = tree.Checkpoint
+		}
+		if err := sync(); err != nil {
+			return done, acked
+		}
+		acked = done
+	}
+	return len(ops), acked
+}
+
+func TestRecoverFromCrashAtAnyByte(t *testing.T) {
+	ops := walOps(300)
+	states := snapshots(ops)
+	for _, policy := range []SyncPolicy{SyncAlways, SyncBatch, SyncNone} {
+		opts := DiskOptions{PageSize: 256, CacheSize: 3, Sync: policy, BatchSize: 8, CheckpointSize: 16 << 10}
+
+		// count the bytes written by the operations without a crash
+		budget := -1
+		data, log := &faultFile{budget: &budget}, &faultFile{budget: &budget}
+		opts.WAL = log
+		tree, err := OpenFile(data, &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		written := len(data.data) + len(log.data)
+		data.checkWAL(log, true)
+		budget = 1 << 30
+		applyOpsWithSyncs(tree, ops, policy)
+		total := 1<<30 - budget
+		if data.broken != nil {
+			t.Fatalf("policy %d: %v", policy, data.broken)
+		}
+
+		r := rand.New(rand.NewSource(int64(policy)))
+		for n := 0; n < 400; n++ {
+			// GIVEN
+			cut := r.Intn(total)
+			budget = -1
+			data, log := &faultFile{budget: &budget}, &faultFile{budget: &budget}
+			opts.WAL = log
+			tree, err := OpenFile(data, &opts)
+			if err != nil || len(data.data)+len(log.data) != written {
+				t.Fatalf("OpenFile() = %v", err)
+			}
+			data.checkWAL(log, true)
+			budget = cut
+
+			// WHEN
+			done, acked := applyOpsWithSyncs(tree, ops, policy)
+			// the crash loses everything which isn't synced
+			reopened, err := reopen(&data.durable, &log.durable, DiskOptions{})
+
+			// THEN
+			if data.broken != nil {
+				t.Fatalf("policy %d, crash at byte %d: %v", policy, cut, data.broken)
+			}
+			if err != nil {
+				t.Fatalf("policy %d, crash at byte %d: reopen = %v", policy, cut, err)
+			}
+			if err := checkDiskBPlusTree(reopened); err != nil {
+				t.Fatalf("policy %d, crash at byte %d: %v", policy, cut, err)
+			}
+			got, err := contents(reopened)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the tree is left after one of the operations, the acknowledged
+			// ones are never lost, and the one which crashed may be committed
+			last := done + 1
+			if last > len(ops) {
+				last = len(ops)
+			}
+			recovered := -1
+			for i := last; i >= acked && recovered < 0; i-- {
+				if equalContents(got, states[i]) {
+					recovered = i
+				}
+			}
+			if recovered < 0 {
+				t.Fatalf("policy %d, crash at byte %d after %d operations: tree has %d keys, want the state after %d to %d operations",
+					policy, cut, done, len(got), acked, last)
+			}
+			if err := tree.Put([]byte("k"), nil); err == nil && done < len(ops) {
+				t.Errorf("tree should refuse operations after the crash")
+			}
+		}
+	}
+}
+
+func TestOpenRecoversWAL(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "index.db")
+	tree, err := Open(path, &DiskOptions{PageSize: 512, CacheSize: 4, Sync: SyncNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i++ {
+		tree.Put(diskKey(i), diskKey(i))
+	}
+	tree.Sync()
+
+	// WHEN
+	// the files are left open without Close, like a crashed process
+	reopened, err := Open(path, nil)
+
+	// THEN
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if err := checkDiskBPlusTree(reopened); err != nil || reopened.Len() != 300 {
+		t.Errorf("reopened tree has %d keys: %v", reopened.Len(), err)
+	}
+}
@@ -3,81 +3,386 @@ package tree
 import (
 	"fmt"
 
+	"github.com/wangwalker/dsal/linear"
 	"golang.org/x/exp/constraints"
 )
 
-// RBNode is the node of the red-black tree.
-type RBNode[T constraints.Ordered] struct {
+// Colors of the red-black tree node.
+const (
+	red   = true
+	black = false
+)
+
+// RBNode is the node of the red-black tree, V is the type of values.
+type RBNode[T constraints.Ordered, V any] struct {
 	key    T
-	value  interface{}
-	left   *RBNode[T]
-	right  *RBNode[T]
-	parent *RBNode[T]
+	value  V
+	left   *RBNode[T, V]
+	right  *RBNode[T, V]
+	parent *RBNode[T, V]
 	color  bool // true: red, false: black
 }
 
 // NewRBNode creates a new red-black node.
-func NewRBNode[T constraints.Ordered](k T, v interface{}) *RBNode[T] {
-	return &RBNode[T]{key: k, value: v}
+func NewRBNode[T constraints.Ordered, V any](k T, v V) *RBNode[T, V] {
+	return &RBNode[T, V]{key: k, value: v}
 }
 
-// Insert inserts a key into the red-black tree.
-func (tree *RBNode[T]) Insert(k T, v interface{}) *RBNode[T] {
-	if tree == nil {
-		return NewRBNode(k, v)
-	}
-	if k < tree.key {
-		tree.left = tree.left.Insert(k, v)
-		tree.left.parent = tree
-	} else if k > tree.key {
-		tree.right = tree.right.Insert(k, v)
-		tree.right.parent = tree
+// Insert inserts a key into the red-black tree and returns the new root. The
+// new node is red, the red-black properties are restored by recoloring and
+// rotations walking up from it. If the key is already in the tree, its value
+// is replaced.
+func (root *RBNode[T, V]) Insert(k T, v V) *RBNode[T, V] {
+	root, _ = root.insert(k, v)
+	return root
+}
+
+// insert inserts a key like Insert in one descent, and reports whether the key
+// is new.
+func (root *RBNode[T, V]) insert(k T, v V) (*RBNode[T, V], bool) {
+	var parent *RBNode[T, V]
+	p := root
+	for p != nil {
+		parent = p
+		if k < p.key {
+			p = p.left
+		} else if k > p.key {
+			p = p.right
+		} else {
+			p.value = v
+			return root, false
+		}
+	}
+	z := NewRBNode(k, v)
+	z.parent = parent
+	if parent == nil {
+		// the new node is the root, which is black
+		return z, true
+	}
+	z.color = red
+	if k < parent.key {
+		parent.left = z
 	} else {
-		return tree
-	}
-	// rebalance the tree
-	if tree.left != nil && tree.left.color {
-		if tree.left.left != nil && tree.left.left.color {
-			tree = tree.rightRotate()
-		} else if tree.left.right != nil && tree.left.right.color {
-			tree.left = tree.left.leftRotate()
-			tree = tree.rightRotate()
+		parent.right = z
+	}
+	return root.insertFixup(z), true
+}
+
+// insertFixup restores the red-black properties after the red node z is
+// inserted, which may have a red parent.
+func (root *RBNode[T, V]) insertFixup(z *RBNode[T, V]) *RBNode[T, V] {
+	for z.parent.isRed() {
+		// the parent is red, so it is not the root and the grandparent exists
+		g := z.parent.parent
+		if z.parent == g.left {
+			u := g.right
+			if u.isRed() {
+				// case 1: the uncle is red, push the red up to the grandparent
+				z.parent.color = black
+				u.color = black
+				g.color = red
+				z = g
+				continue
+			}
+			if z == z.parent.right {
+				// case 2: z is an inner child, turn it into case 3
+				z = z.parent
+				root = root.rotateLeft(z)
+			}
+			// case 3: z is an outer child
+			z.parent.color = black
+			g.color = red
+			root = root.rotateRight(g)
+		} else {
+			u := g.left
+			if u.isRed() {
+				z.parent.color = black
+				u.color = black
+				g.color = red
+				z = g
+				continue
+			}
+			if z == z.parent.left {
+				z = z.parent
+				root = root.rotateRight(z)
+			}
+			z.parent.color = black
+			g.color = red
+			root = root.rotateLeft(g)
 		}
-	} else if tree.right != nil && tree.right.color {
-		if tree.right.right != nil && tree.right.right.color {
-			tree = tree.leftRotate()
-		} else if tree.right.left != nil && tree.right.left.color {
-			tree.right = tree.right.rightRotate()
-			tree = tree.leftRotate()
+	}
+	root.color = black
+	return root
+}
+
+// Delete deletes a key from the red-black tree and returns the new root, if
+// the key is not in the tree, nothing happens. The node holding the key is
+// unlinked instead of copying the successor's key and value into it, so other
+// nodes keep their identities and parent pointers stay consistent.
+func (root *RBNode[T, V]) Delete(k T) *RBNode[T, V] {
+	root, _ = root.delete(k)
+	return root
+}
+
+// delete deletes a key like Delete in one descent, and reports whether the key
+// was in the tree.
+func (root *RBNode[T, V]) delete(k T) (*RBNode[T, V], bool) {
+	z := root.search(k)
+	if z == nil {
+		return root, false
+	}
+	// y is the node removed from or moved within the tree, x is the node which
+	// takes y's original position, x may be nil so its parent is tracked.
+	var x, xParent *RBNode[T, V]
+	y := z
+	yColor := y.color
+	if z.left == nil {
+		x, xParent = z.right, z.parent
+		root = root.transplant(z, z.right)
+	} else if z.right == nil {
+		x, xParent = z.left, z.parent
+		root = root.transplant(z, z.left)
+	} else {
+		// the deleted node has two children, replace it with its successor
+		y = z.right.min()
+		yColor = y.color
+		x = y.right
+		if y.parent == z {
+			xParent = y
+		} else {
+			xParent = y.parent
+			root = root.transplant(y, y.right)
+			y.right = z.right
+			y.right.parent = y
+		}
+		root = root.transplant(z, y)
+		y.left = z.left
+		y.left.parent = y
+		y.color = z.color
+	}
+	z.left, z.right, z.parent = nil, nil, nil
+	if yColor == black {
+		root = root.deleteFixup(x, xParent)
+	}
+	return root, true
+}
+
+// deleteFixup restores the red-black properties after a black node is removed,
+// x carries an extra black and parent is its parent because x may be nil.
+func (root *RBNode[T, V]) deleteFixup(x, parent *RBNode[T, V]) *RBNode[T, V] {
+	for x != root && !x.isRed() {
+		if x == parent.left {
+			w := parent.right
+			if w.isRed() {
+				// case 1: the sibling is red, turn it into case 2, 3 or 4
+				w.color = black
+				parent.color = red
+				root = root.rotateLeft(parent)
+				w = parent.right
+			}
+			if !w.left.isRed() && !w.right.isRed() {
+				// case 2: both children of the sibling are black, move the
+				// extra black up
+				w.color = red
+				x, parent = parent, parent.parent
+				continue
+			}
+			if !w.right.isRed() {
+				// case 3: only the left child of the sibling is red, turn it
+				// into case 4
+				w.left.color = black
+				w.color = red
+				root = root.rotateRight(w)
+				w = parent.right
+			}
+			// case 4: the right child of the sibling is red
+			w.color = parent.color
+			parent.color = black
+			w.right.color = black
+			root = root.rotateLeft(parent)
+			x = root
+		} else {
+			w := parent.left
+			if w.isRed() {
+				w.color = black
+				parent.color = red
+				root = root.rotateRight(parent)
+				w = parent.left
+			}
+			if !w.left.isRed() && !w.right.isRed() {
+				w.color = red
+				x, parent = parent, parent.parent
+				continue
+			}
+			if !w.left.isRed() {
+				w.right.color = black
+				w.color = red
+				root = root.rotateLeft(w)
+				w = parent.left
+			}
+			w.color = parent.color
+			parent.color = black
+			w.left.color = black
+			root = root.rotateRight(parent)
+			x = root
 		}
 	}
+	if x != nil {
+		x.color = black
+	}
+	return root
+}
+
+// transplant replaces the subtree rooted at u with the subtree rooted at v,
+// and returns the new root of the whole tree.
+func (root *RBNode[T, V]) transplant(u, v *RBNode[T, V]) *RBNode[T, V] {
+	if u.parent == nil {
+		root = v
+	} else if u == u.parent.left {
+		u.parent.left = v
+	} else {
+		u.parent.right = v
+	}
+	if v != nil {
+		v.parent = u.parent
+	}
+	return root
+}
+
+// rotateLeft rotates the subtree rooted at x to the left without changing
+// colors, keeps parent pointers consistent and returns the new root of the
+// whole tree.
+func (root *RBNode[T, V]) rotateLeft(x *RBNode[T, V]) *RBNode[T, V] {
+	y := x.right
+	x.right = y.left
+	if y.left != nil {
+		y.left.parent = x
+	}
+	root = root.transplant(x, y)
+	y.left = x
+	x.parent = y
+	return root
+}
+
+// rotateRight rotates the subtree rooted at x to the right without changing
+// colors, keeps parent pointers consistent and returns the new root of the
+// whole tree.
+func (root *RBNode[T, V]) rotateRight(x *RBNode[T, V]) *RBNode[T, V] {
+	y := x.left
+	x.left = y.right
+	if y.right != nil {
+		y.right.parent = x
+	}
+	root = root.transplant(x, y)
+	y.right = x
+	x.parent = y
+	return root
+}
+
+// Search searches key in the red-black tree, if the key is found, the value of
+// the node is returned with true, otherwise the zero value and false are
+// returned.
+func (tree *RBNode[T, V]) Search(k T) (V, bool) {
+	node := tree.search(k)
+	if node == nil {
+		var zero V
+		return zero, false
+	}
+	return node.value, true
+}
+
+// search returns the node holding the key, or nil if the key is not found.
+func (tree *RBNode[T, V]) search(k T) *RBNode[T, V] {
+	for tree != nil && k != tree.key {
+		if k < tree.key {
+			tree = tree.left
+		} else {
+			tree = tree.right
+		}
+	}
+	return tree
+}
+
+// min returns the node with the minimum key in the tree.
+func (tree *RBNode[T, V]) min() *RBNode[T, V] {
+	for tree.left != nil {
+		tree = tree.left
+	}
+	return tree
+}
+
+// max returns the node with the maximum key in the tree.
+func (tree *RBNode[T, V]) max() *RBNode[T, V] {
+	for tree.right != nil {
+		tree = tree.right
+	}
 	return tree
 }
 
-// leftRotate rotates the tree to the left.
-func (tree *RBNode[T]) leftRotate() *RBNode[T] {
-	right := tree.right
-	tree.right = right.left
-	right.left = tree
-	right.color = tree.color
-	tree.color = true
-	return right
+// isRed reports whether the node is red, nil nodes are black.
+func (tree *RBNode[T, V]) isRed() bool {
+	return tree != nil && tree.color == red
 }
 
-// rightRotate rotates the tree to the right.
-func (tree *RBNode[T]) rightRotate() *RBNode[T] {
-	left := tree.left
-	tree.left = left.right
-	left.right = tree
-	left.color = tree.color
-	tree.color = true
-	return left
+// Validate checks the red-black properties of the tree: the root is black,
+// no red node has a red child, every path from a node to its nil leaves has
+// the same number of black nodes, keys are in BST order and parent pointers
+// are consistent. It returns an error describing the first violation found.
+func (root *RBNode[T, V]) Validate() error {
+	if root == nil {
+		return nil
+	}
+	if root.color != black {
+		return fmt.Errorf("root %v is red", root.key)
+	}
+	if root.parent != nil {
+		return fmt.Errorf("root %v has parent %v", root.key, root.parent.key)
+	}
+	_, err := root.validateSubtree(nil, nil)
+	return err
+}
+
+// validateSubtree checks the subtree whose keys must be in (lo, hi), nil
+// bounds are unlimited, and returns its black height.
+func (tree *RBNode[T, V]) validateSubtree(lo, hi *T) (int, error) {
+	if tree == nil {
+		return 1, nil
+	}
+	if (lo != nil && tree.key <= *lo) || (hi != nil && tree.key >= *hi) {
+		return 0, fmt.Errorf("key %v breaks BST order", tree.key)
+	}
+	for _, child := range []*RBNode[T, V]{tree.left, tree.right} {
+		if child == nil {
+			continue
+		}
+		if child.parent != tree {
+			return 0, fmt.Errorf("key %v has wrong parent", child.key)
+		}
+		if tree.isRed() && child.isRed() {
+			return 0, fmt.Errorf("red key %v has red child %v", tree.key, child.key)
+		}
+	}
+	lh, err := tree.left.validateSubtree(lo, &tree.key)
+	if err != nil {
+		return 0, err
+	}
+	rh, err := tree.right.validateSubtree(&tree.key, hi)
+	if err != nil {
+		return 0, err
+	}
+	if lh != rh {
+		return 0, fmt.Errorf("key %v has black heights %d and %d", tree.key, lh, rh)
+	}
+	if !tree.isRed() {
+		lh++
+	}
+	return lh, nil
 }
 
 // traverse traverses the tree in-order.
 //
 //lint:ignore U1000 Ignore unused function temporarily for debugging
-func (tree *RBNode[T]) traverse() {
+func (tree *RBNode[T, V]) traverse() {
 	if tree == nil {
 		return
 	}
@@ -89,3 +394,206 @@ func (tree *RBNode[T]) traverse() {
 	}
 	tree.right.traverse()
 }
+
+// RBIterator walks the nodes of a red-black tree in order with an explicit
+// stack instead of recursion, the stack holds the nodes whose keys are not
+// visited yet along the current path. The tree must not be modified during
+// iteration.
+type RBIterator[T constraints.Ordered, V any] struct {
+	stack   linear.Stack[*RBNode[T, V]]
+	reverse bool
+}
+
+// Iterator returns an iterator which walks the keys in ascending order.
+func (tree *RBNode[T, V]) Iterator() *RBIterator[T, V] {
+	it := &RBIterator[T, V]{}
+	it.pushPath(tree)
+	return it
+}
+
+// ReverseIterator returns an iterator which walks the keys in descending order.
+func (tree *RBNode[T, V]) ReverseIterator() *RBIterator[T, V] {
+	it := &RBIterator[T, V]{reverse: true}
+	it.pushPath(tree)
+	return it
+}
+
+// seekIterator returns an iterator which walks the keys not less than lo in
+// ascending order.
+func (tree *RBNode[T, V]) seekIterator(lo T) *RBIterator[T, V] {
+	it := &RBIterator[T, V]{}
+	for p := tree; p != nil; {
+		if p.key < lo {
+			p = p.right
+		} else {
+			it.stack.Push(p)
+			p = p.left
+		}
+	}
+	return it
+}
+
+// Next returns the next key with its value, the last result is false when all
+// keys have been visited.
+func (it *RBIterator[T, V]) Next() (T, V, bool) {
+	node := it.next()
+	if node == nil {
+		var k T
+		var v V
+		return k, v, false
+	}
+	return node.key, node.value, true
+}
+
+// next returns the next node, or nil when all nodes have been visited.
+func (it *RBIterator[T, V]) next() *RBNode[T, V] {
+	node, ok := it.stack.Pop()
+	if !ok {
+		return nil
+	}
+	if it.reverse {
+		it.pushPath(node.left)
+	} else {
+		it.pushPath(node.right)
+	}
+	return node
+}
+
+// pushPath pushes the node and its left spine, or its right spine when the
+// iterator is reversed.
+func (it *RBIterator[T, V]) pushPath(node *RBNode[T, V]) {
+	for node != nil {
+		it.stack.Push(node)
+		if it.reverse {
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+}
+
+// Ascend calls f for every key with its value in ascending order, the
+// iteration stops when f returns false.
+func (tree *RBNode[T, V]) Ascend(f func(k T, v V) bool) {
+	it := tree.Iterator()
+	for n := it.next(); n != nil && f(n.key, n.value); n = it.next() {
+	}
+}
+
+// Descend calls f for every key with its value in descending order, the
+// iteration stops when f returns false.
+func (tree *RBNode[T, V]) Descend(f func(k T, v V) bool) {
+	it := tree.ReverseIterator()
+	for n := it.next(); n != nil && f(n.key, n.value); n = it.next() {
+	}
+}
+
+// AscendRange calls f for every key in [lo, hi) with its value in ascending
+// order, the iteration stops when f returns false.
+func (tree *RBNode[T, V]) AscendRange(lo, hi T, f func(k T, v V) bool) {
+	it := tree.seekIterator(lo)
+	for n := it.next(); n != nil && n.key < hi && f(n.key, n.value); n = it.next() {
+	}
+}
+
+// RBTree is an ordered map backed by a red-black tree, it owns the root node
+// so callers never handle the roots returned by Insert and Delete. The zero
+// value is an empty map ready to use.
+type RBTree[K constraints.Ordered, V any] struct {
+	root *RBNode[K, V]
+	size int
+}
+
+// NewRBTree returns a new empty red-black tree map.
+func NewRBTree[K constraints.Ordered, V any]() *RBTree[K, V] {
+	return &RBTree[K, V]{}
+}
+
+// Len returns the number of keys in the map.
+func (m *RBTree[K, V]) Len() int {
+	return m.size
+}
+
+// Get returns the value of the key, the second result is false if the key is
+// not in the map.
+func (m *RBTree[K, V]) Get(k K) (V, bool) {
+	node := m.root.search(k)
+	if node == nil {
+		var zero V
+		return zero, false
+	}
+	return node.value, true
+}
+
+// Put inserts the key with the value into the map, if the key is already in
+// the map, its value is replaced.
+func (m *RBTree[K, V]) Put(k K, v V) {
+	var added bool
+	m.root, added = m.root.insert(k, v)
+	if added {
+		m.size++
+	}
+}
+
+// Delete deletes the key from the map and reports whether it was present.
+func (m *RBTree[K, V]) Delete(k K) bool {
+	var deleted bool
+	m.root, deleted = m.root.delete(k)
+	if deleted {
+		m.size--
+	}
+	return deleted
+}
+
+// Min returns the minimum key with its value, the last result is false if the
+// map is empty.
+func (m *RBTree[K, V]) Min() (K, V, bool) {
+	if m.root == nil {
+		var k K
+		var v V
+		return k, v, false
+	}
+	node := m.root.min()
+	return node.key, node.value, true
+}
+
+// Max returns the maximum key with its value, the last result is false if the
+// map is empty.
+func (m *RBTree[K, V]) Max() (K, V, bool) {
+	if m.root == nil {
+		var k K
+		var v V
+		return k, v, false
+	}
+	node := m.root.max()
+	return node.key, node.value, true
+}
+
+// Ascend calls f for every key with its value in ascending order, the
+// iteration stops when f returns false.
+func (m *RBTree[K, V]) Ascend(f func(k K, v V) bool) {
+	it := m.root.Iterator()
+	for n := it.next(); n != nil && f(n.key, n.value); n = it.next() {
+	}
+}
+
+// Descend calls f for every key with its value in descending order, the
+// iteration stops when f returns false.
+func (m *RBTree[K, V]) Descend(f func(k K, v V) bool) {
+	it := m.root.ReverseIterator()
+	for n := it.next(); n != nil && f(n.key, n.value); n = it.next() {
+	}
+}
+
+// AscendRange calls f for every key in [lo, hi) with its value in ascending
+// order, the iteration stops when f returns false.
+func (m *RBTree[K, V]) AscendRange(lo, hi K, f func(k K, v V) bool) {
+	it := m.root.seekIterator(lo)
+	for n := it.next(); n != nil && n.key < hi && f(n.key, n.value); n = it.next() {
+	}
+}
+
+// Validate checks the red-black properties of the underlying tree.
+func (m *RBTree[K, V]) Validate() error {
+	return m.root.Validate()
+}
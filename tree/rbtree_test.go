@@ -0,0 +1,444 @@
+package tree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// buildRBTree builds a valid red-black tree from sorted keys by picking the
+// middle key as root, the nodes at the deepest level are red when it is not
+// the only level.
+func buildRBTree(keys []int) *RBNode[int, int] {
+	var build func(lo, hi int, parent *RBNode[int, int]) *RBNode[int, int]
+	build = func(lo, hi int, parent *RBNode[int, int]) *RBNode[int, int] {
+		if lo >= hi {
+			return nil
+		}
+		mid := (lo + hi) / 2
+		node := NewRBNode(keys[mid], keys[mid]*10)
+		node.parent = parent
+		node.left = build(lo, mid, node)
+		node.right = build(mid+1, hi, node)
+		return node
+	}
+	root := build(0, len(keys), nil)
+	var height func(node *RBNode[int, int]) int
+	height = func(node *RBNode[int, int]) int {
+		if node == nil {
+			return 0
+		}
+		return max(height(node.left), height(node.right)) + 1
+	}
+	maxLevel := height(root)
+	var color func(node *RBNode[int, int], level int)
+	color = func(node *RBNode[int, int], level int) {
+		if node == nil {
+			return
+		}
+		node.color = level == maxLevel && level > 1
+		color(node.left, level+1)
+		color(node.right, level+1)
+	}
+	color(root, 1)
+	return root
+}
+
+// rbKeys returns the keys of the tree in order.
+func rbKeys[V any](tree *RBNode[int, V]) []int {
+	if tree == nil {
+		return nil
+	}
+	keys := rbKeys(tree.left)
+	keys = append(keys, tree.key)
+	return append(keys, rbKeys(tree.right)...)
+}
+
+func TestBuildValidRBTree(t *testing.T) {
+	for n := 0; n < 100; n++ {
+		keys := make([]int, n)
+		for i := range keys {
+			keys[i] = i
+		}
+		if err := buildRBTree(keys).Validate(); err != nil {
+			t.Fatalf("tree of %d keys is invalid: %v", n, err)
+		}
+	}
+}
+
+func TestDeleteRBTreeLeafAndInnerNodes(t *testing.T) {
+	// GIVEN
+	root := buildRBTree([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+
+	// WHEN
+	root = root.Delete(root.key)
+	root = root.Delete(1)
+	root = root.Delete(10)
+	root = root.Delete(42)
+
+	// THEN
+	if err := root.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := []int{2, 3, 4, 5, 7, 8, 9}
+	got := rbKeys(root)
+	if len(got) != len(want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("keys = %v, want %v", got, want)
+		}
+	}
+	if node := root.search(4); node == nil || node.value != 40 {
+		t.Errorf("search(4) should keep its value")
+	}
+}
+
+func TestDeleteRBTreeUntilEmpty(t *testing.T) {
+	// GIVEN
+	keys := make([]int, 64)
+	for i := range keys {
+		keys[i] = i
+	}
+	root := buildRBTree(keys)
+
+	// WHEN
+	for _, k := range keys {
+		root = root.Delete(k)
+		if err := root.Validate(); err != nil {
+			t.Fatalf("after deleting %d: %v", k, err)
+		}
+	}
+
+	// THEN
+	if root != nil {
+		t.Errorf("root = %v, want nil", root.key)
+	}
+}
+
+func TestDeleteRBTreeRandomly(t *testing.T) {
+	r := rand.New(rand.NewSource(31))
+	for round := 0; round < 50; round++ {
+		// GIVEN
+		n := r.Intn(300) + 1
+		keys := make([]int, n)
+		for i := range keys {
+			keys[i] = i * 2
+		}
+		root := buildRBTree(keys)
+		model := make(map[int]bool)
+		for _, k := range keys {
+			model[k] = true
+		}
+
+		// WHEN
+		for _, i := range r.Perm(2 * n) {
+			root = root.Delete(i)
+			delete(model, i)
+
+			// THEN
+			if err := root.Validate(); err != nil {
+				t.Fatalf("after deleting %d: %v", i, err)
+			}
+			if got := len(rbKeys(root)); got != len(model) {
+				t.Fatalf("tree has %d keys, want %d", got, len(model))
+			}
+		}
+	}
+}
+
+func TestInsertRBTreeKeepsColorInvariants(t *testing.T) {
+	// GIVEN
+	var root *RBNode[int, int]
+
+	// WHEN
+	for i := 1; i <= 100; i++ {
+		root = root.Insert(i, i*10)
+		if err := root.Validate(); err != nil {
+			t.Fatalf("after inserting %d: %v", i, err)
+		}
+	}
+
+	// THEN
+	if root.color != black {
+		t.Error("root should be black")
+	}
+	height := 0
+	for p := root; p != nil; p = p.left {
+		height++
+	}
+	// the height of a red-black tree with n keys is at most 2*log2(n+1)
+	if height > 14 {
+		t.Errorf("left spine has %d nodes, the tree is not balanced", height)
+	}
+	if node := root.search(42); node == nil || node.value != 420 {
+		t.Error("search(42) should find the value")
+	}
+}
+
+func TestInsertRBTreeWithExistingKey(t *testing.T) {
+	// GIVEN
+	root := NewRBNode(2, "b")
+	root = root.Insert(1, "a")
+	root = root.Insert(3, "c")
+
+	// WHEN
+	root = root.Insert(1, "x")
+
+	// THEN
+	if err := root.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := rbKeys(root); len(got) != 3 {
+		t.Errorf("keys = %v, want [1 2 3]", got)
+	}
+	if v, ok := root.Search(1); !ok || v != "x" {
+		t.Errorf("Search(1) = %v, %v, want x, true", v, ok)
+	}
+}
+
+func TestValidateDetectsViolations(t *testing.T) {
+	newTree := func() *RBNode[int, int] {
+		root := NewRBNode(2, 20)
+		root = root.Insert(1, 10)
+		return root.Insert(3, 30)
+	}
+	tests := []struct {
+		name    string
+		corrupt func(root *RBNode[int, int])
+	}{
+		{"red root", func(root *RBNode[int, int]) { root.color = red }},
+		{"red-red edge", func(root *RBNode[int, int]) {
+			root.left.left = &RBNode[int, int]{key: 0, parent: root.left, color: red}
+		}},
+		{"unequal black heights", func(root *RBNode[int, int]) { root.left.color = black }},
+		{"broken BST order", func(root *RBNode[int, int]) { root.left.key = 5 }},
+		{"wrong parent", func(root *RBNode[int, int]) { root.left.parent = root.right }},
+	}
+	for _, tt := range tests {
+		// GIVEN
+		root := newTree()
+		if err := root.Validate(); err != nil {
+			t.Fatalf("valid tree: %v", err)
+		}
+
+		// WHEN
+		tt.corrupt(root)
+
+		// THEN
+		if err := root.Validate(); err == nil {
+			t.Errorf("Validate() should report %s", tt.name)
+		}
+	}
+}
+
+func TestInsertAndDeleteRBTreeRandomly(t *testing.T) {
+	r := rand.New(rand.NewSource(32))
+	for round := 0; round < 20; round++ {
+		// GIVEN
+		var root *RBNode[int, int]
+		model := make(map[int]bool)
+
+		// WHEN
+		for i := 0; i < 2000; i++ {
+			k := r.Intn(500)
+			if r.Intn(3) == 0 {
+				root = root.Delete(k)
+				delete(model, k)
+			} else {
+				root = root.Insert(k, k)
+				model[k] = true
+			}
+
+			// THEN
+			if err := root.Validate(); err != nil {
+				t.Fatalf("after operation %d on key %d: %v", i, k, err)
+			}
+		}
+		keys := rbKeys(root)
+		if len(keys) != len(model) {
+			t.Fatalf("tree has %d keys, want %d", len(keys), len(model))
+		}
+		for _, k := range keys {
+			if !model[k] {
+				t.Fatalf("key %d should not be in the tree", k)
+			}
+		}
+	}
+}
+
+func TestSearchRBNode(t *testing.T) {
+	// GIVEN
+	root := NewRBNode(2, "b")
+	root = root.Insert(1, "a")
+
+	// WHEN
+	v1, ok1 := root.Search(1)
+	v3, ok3 := root.Search(3)
+
+	// THEN
+	if !ok1 || v1 != "a" {
+		t.Errorf("Search(1) = %v, %v, want a, true", v1, ok1)
+	}
+	if ok3 || v3 != "" {
+		t.Errorf("Search(3) = %q, %v, want \"\", false", v3, ok3)
+	}
+}
+
+func TestRBTreeMap(t *testing.T) {
+	// GIVEN
+	m := NewRBTree[string, int]()
+	m.Put("b", 2)
+	m.Put("a", 1)
+	m.Put("c", 3)
+
+	// WHEN
+	m.Put("a", 10)
+	deleted := m.Delete("b")
+	notDeleted := m.Delete("z")
+
+	// THEN
+	if !deleted || notDeleted {
+		t.Errorf("Delete() = %v, %v, want true, false", deleted, notDeleted)
+	}
+	if m.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", m.Len())
+	}
+	if v, ok := m.Get("a"); !ok || v != 10 {
+		t.Errorf("Get(a) = %d, %v, want 10, true", v, ok)
+	}
+	if _, ok := m.Get("b"); ok {
+		t.Error("Get(b) should return false")
+	}
+	if k, v, ok := m.Min(); !ok || k != "a" || v != 10 {
+		t.Errorf("Min() = %q, %d, %v, want a, 10, true", k, v, ok)
+	}
+	if k, v, ok := m.Max(); !ok || k != "c" || v != 3 {
+		t.Errorf("Max() = %q, %d, %v, want c, 3, true", k, v, ok)
+	}
+}
+
+func TestEmptyRBTreeMap(t *testing.T) {
+	// GIVEN
+	var m RBTree[int, error]
+
+	// WHEN
+	m.Put(1, nil)
+
+	// THEN
+	if v, ok := m.Get(1); !ok || v != nil {
+		t.Errorf("Get(1) = %v, %v, want nil, true", v, ok)
+	}
+	m.Delete(1)
+	if _, _, ok := m.Min(); ok {
+		t.Error("Min() should return false")
+	}
+	if _, _, ok := m.Max(); ok {
+		t.Error("Max() should return false")
+	}
+}
+
+func TestRBTreeMapRandomly(t *testing.T) {
+	// GIVEN
+	r := rand.New(rand.NewSource(33))
+	m := NewRBTree[int, int]()
+	model := make(map[int]int)
+
+	// WHEN
+	for i := 0; i < 5000; i++ {
+		k := r.Intn(300)
+		if r.Intn(3) == 0 {
+			_, exist := model[k]
+			if ok := m.Delete(k); ok != exist {
+				t.Fatalf("Delete(%d) = %v, want %v", k, ok, exist)
+			}
+			delete(model, k)
+		} else {
+			m.Put(k, i)
+			model[k] = i
+		}
+	}
+
+	// THEN
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != len(model) {
+		t.Fatalf("Len() = %d, want %d", m.Len(), len(model))
+	}
+	for k, want := range model {
+		if v, ok := m.Get(k); !ok || v != want {
+			t.Fatalf("Get(%d) = %d, %v, want %d, true", k, v, ok, want)
+		}
+	}
+}
+
+func TestRBTreeIterators(t *testing.T) {
+	// GIVEN
+	var root *RBNode[int, int]
+	for _, k := range rand.New(rand.NewSource(34)).Perm(50) {
+		root = root.Insert(k, k*10)
+	}
+
+	// WHEN
+	var forward, reverse []int
+	it := root.Iterator()
+	for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+		if v != k*10 {
+			t.Fatalf("value of %d = %v, want %d", k, v, k*10)
+		}
+		forward = append(forward, k)
+	}
+	rit := root.ReverseIterator()
+	for k, _, ok := rit.Next(); ok; k, _, ok = rit.Next() {
+		reverse = append(reverse, k)
+	}
+
+	// THEN
+	if len(forward) != 50 || len(reverse) != 50 {
+		t.Fatalf("iterators visit %d and %d keys, want 50", len(forward), len(reverse))
+	}
+	for i := 0; i < 50; i++ {
+		if forward[i] != i || reverse[i] != 49-i {
+			t.Fatalf("forward = %v, reverse = %v", forward, reverse)
+		}
+	}
+}
+
+func TestRBTreeAscendRangeAndDescend(t *testing.T) {
+	// GIVEN
+	m := NewRBTree[int, string]()
+	for i := 0; i < 20; i++ {
+		m.Put(i, string(rune('a'+i)))
+	}
+
+	// WHEN
+	var keys []int
+	var values string
+	m.AscendRange(5, 9, func(k int, v string) bool {
+		keys = append(keys, k)
+		values += v
+		return true
+	})
+	var desc []int
+	m.Descend(func(k int, v string) bool {
+		desc = append(desc, k)
+		return k > 17
+	})
+
+	// THEN
+	if len(keys) != 4 || keys[0] != 5 || keys[3] != 8 || values != "fghi" {
+		t.Errorf("AscendRange(5, 9) visits %v with %q", keys, values)
+	}
+	if len(desc) != 3 || desc[0] != 19 || desc[2] != 17 {
+		t.Errorf("Descend() visits %v, want [19 18 17]", desc)
+	}
+	var asc []int
+	m.Ascend(func(k int, v string) bool {
+		asc = append(asc, k)
+		return len(asc) < 3
+	})
+	if len(asc) != 3 || asc[2] != 2 {
+		t.Errorf("Ascend() visits %v, want [0 1 2]", asc)
+	}
+}